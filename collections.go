@@ -0,0 +1,435 @@
+package structconf
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// isStructElem returns whether elements of a collection of the given type are structs (or pointers to structs) whose
+// fields are configured individually, instead of being parsed from a single value.
+func (r *structReflector) isStructElem(elemType reflect.Type) bool {
+	if r.isValueType(elemType) {
+		return false
+	}
+
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+
+	return elemType.Kind() == reflect.Struct
+}
+
+// recurseStructSlice creates flags for every element of a slice of structs, such as []UpstreamConfig.
+//
+// The number of elements is discovered from arrays of tables in config files, and from indexed env vars or flags
+// such as UPSTREAM_0_URL or --upstream-0-url. The fields of each element are configured by its index, e.g.
+// --upstream-0-url or upstream.0.url. Gaps in the indices result in zero value elements. Arrays of tables of multiple
+// config files are merged as a whole, according to the merge tag of the field, see resolveCollection. Elements are only
+// discovered from flags if the CLI args are known at reflection time, which isn't the case for bound commands.
+func (r *structReflector) recurseStructSlice(field reflect.StructField, fieldValue reflect.Value, tags *configFieldTags, parents []*configFieldTags) error {
+	if tags.flag == "-" {
+		return nil
+	}
+
+	if err := validateMergeStrategy(field, tags); err != nil {
+		return err
+	}
+
+	collection := r.resolveCollection(tags, parents)
+
+	length := 0
+	for _, key := range r.discoverCollectionKeys(field.Type.Elem(), tags, parents, collection.keys()) {
+		if index, err := strconv.Atoi(key); err == nil && index >= 0 {
+			length = max(length, index+1)
+		}
+	}
+
+	if length == 0 { // elements allocated by an earlier pass, such as the first pass of LoadAndValidate, are discarded
+		fieldValue.SetZero()
+		return nil
+	}
+
+	nested := slices.Clone(parents)
+	nested = append(nested, tags)
+
+	elements := reflect.MakeSlice(field.Type, length, length)
+	for i := range length {
+		key := strconv.Itoa(i)
+		err := r.withMapSources(collection.sources(key), func() error {
+			return r.recurseStruct(newStructElem(elements.Index(i)), append(slices.Clone(nested), indexTags(key)))
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	fieldValue.Set(elements)
+	return nil
+}
+
+// recurseStructMap creates flags for every instance of a map of structs, such as map[string]DatabaseConfig.
+//
+// The keys of the map are discovered from tables in config files, and from env vars or flags such as
+// DATABASES_PRIMARY_HOST or --databases-primary-host. Like for slices of structs, keys are only discovered from flags
+// if the CLI args are known at reflection time.
+// The fields of each instance are configured by its key, e.g. --databases-primary-host or databases.primary.host.
+// Tables of multiple config files are merged as a whole, according to the merge tag of the field, see
+// resolveCollection.
+func (r *structReflector) recurseStructMap(field reflect.StructField, fieldValue reflect.Value, tags *configFieldTags, parents []*configFieldTags) error {
+	if tags.flag == "-" {
+		return nil
+	}
+
+	if field.Type.Key().Kind() != reflect.String {
+		return fmt.Errorf("unsupported map key type %s for field %s, only string keys are supported", field.Type.Key().Kind(), field.Name)
+	}
+
+	if err := validateMergeStrategy(field, tags); err != nil {
+		return err
+	}
+
+	collection := r.resolveCollection(tags, parents)
+
+	keys := r.discoverCollectionKeys(field.Type.Elem(), tags, parents, collection.keys())
+	if len(keys) == 0 { // instances allocated by an earlier pass, such as the first pass of LoadAndValidate, are discarded
+		fieldValue.SetZero()
+		return nil
+	}
+
+	nested := slices.Clone(parents)
+	nested = append(nested, tags)
+
+	instances := reflect.MakeMapWithSize(field.Type, len(keys))
+	for _, key := range keys {
+		instance := reflect.New(field.Type.Elem()).Elem()
+		err := r.withMapSources(collection.sources(key), func() error {
+			return r.recurseStruct(newStructElem(instance), append(slices.Clone(nested), keyTags(key)))
+		})
+		if err != nil {
+			return err
+		}
+
+		// map elements are not addressable, so struct values are copied into the map once all their fields are set
+		mapKey := reflect.ValueOf(key).Convert(field.Type.Key())
+		r.applyFuncs = append(r.applyFuncs, func(*cli.Command) {
+			instances.SetMapIndex(mapKey, instance)
+		})
+	}
+
+	fieldValue.Set(instances)
+	return nil
+}
+
+// discoverCollectionKeys returns the sorted keys of all elements configured for a collection of structs, which are
+// map keys or slice indices. Keys are the given keys of the collection resolved from config files, as well as keys
+// read from env vars and flags consisting of the name of the collection, the key and the name of one of the fields of
+// the struct, e.g. DATABASES_PRIMARY_HOST or --databases-primary-host. Keys found in env vars are lowercased.
+func (r *structReflector) discoverCollectionKeys(elemType reflect.Type, tags *configFieldTags, parents []*configFieldTags, fileKeys []string) []string {
+	keys := make(map[string]struct{}, len(fileKeys))
+
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+
+	for _, key := range fileKeys {
+		keys[key] = struct{}{}
+	}
+
+	if tags.env != "-" {
+		envKey := func(t *configFieldTags) string { return t.env }
+		prefix := r.envKey(tags, parents) + "_"
+		fieldEnvKeys := r.structFieldKeys(elemType, nil, envKey, "_")
+
+		for _, name := range envNames(r.dotEnv) {
+			key, ok := collectionKey(name, prefix, "_", fieldEnvKeys)
+			if fileKey, isFileKey := strings.CutSuffix(name, envFileSuffix); !ok && isFileKey {
+				// values of fields can also be read from <KEY>_FILE env vars, unless the env var belongs to a field itself
+				key, ok = collectionKey(fileKey, prefix, "_", fieldEnvKeys)
+			}
+			if ok {
+				keys[strings.ToLower(key)] = struct{}{}
+			}
+		}
+	}
+
+	flagKey := func(t *configFieldTags) string { return t.flag }
+	prefix := fieldKey(tags, parents, flagKey, "-") + "-"
+	fieldFlagNames := r.structFieldKeys(elemType, nil, flagKey, "-")
+
+	for _, name := range argFlagNames(r.args) {
+		if key, ok := collectionKey(name, prefix, "-", fieldFlagNames); ok {
+			keys[key] = struct{}{}
+		}
+	}
+
+	return slices.Sorted(maps.Keys(keys))
+}
+
+// resolvedCollection is a collection of structs resolved from config files, which maps each of its elements to the map
+// sources the fields of the element are looked up in.
+type resolvedCollection struct {
+	elements map[string][]cli.MapSource // sources of the elements defined in config files, by key
+	others   []cli.MapSource            // sources of elements only configured by env vars or flags
+}
+
+// keys returns the keys of all elements defined in config files.
+func (c *resolvedCollection) keys() []string {
+	return slices.Collect(maps.Keys(c.elements))
+}
+
+// sources returns the map sources the fields of the element with the given key are looked up in.
+func (c *resolvedCollection) sources(key string) []cli.MapSource {
+	if sources, ok := c.elements[key]; ok {
+		return sources
+	}
+
+	return c.others
+}
+
+// resolveCollection resolves a collection of structs as a whole from all config files defining it, using the merge
+// strategy of the field, instead of looking up each field of each element in all config files.
+//
+// By default, only the array or table of the config file with the highest precedence is used, so that the fields of
+// an element are never combined from multiple files. With `merge:"append"`, the arrays of all files are concatenated,
+// and with `merge:"deep"`, the tables of all files are merged key by key. Sources which don't define the collection
+// as a whole, such as config directories or config files loaded lazily, are still looked up field by field.
+func (r *structReflector) resolveCollection(tags *configFieldTags, parents []*configFieldTags) *resolvedCollection {
+	collection := &resolvedCollection{
+		elements: make(map[string][]cli.MapSource),
+		others:   r.mapSources,
+	}
+
+	var defining []int // indices of the sources defining the collection, in order of precedence
+	values := make(map[int]any)
+
+	for i, source := range r.mapSources {
+		if _, ok := source.(mapSourceGroup); ok { // config files loaded lazily are not known at reflection time
+			continue
+		}
+
+		sourceKey, ok := mapSourceKey(source, tags, parents)
+		if !ok {
+			continue
+		}
+
+		// empty arrays and tables define the collection as well, so that they unset it in sources of lower precedence
+		if value, ok := source.Lookup(sourceKey); ok && collectionKeys(value) != nil {
+			defining = append(defining, i)
+			values[i] = value
+		}
+	}
+
+	if len(defining) == 0 {
+		return collection
+	}
+
+	// withOnly returns all sources, except for the ones defining the collection other than the one at the given index,
+	// which is replaced by the given source
+	withOnly := func(index int, replacement cli.MapSource) []cli.MapSource {
+		sources := make([]cli.MapSource, 0, len(r.mapSources))
+		for i, source := range r.mapSources {
+			switch {
+			case i == index:
+				sources = append(sources, replacement)
+			case !slices.Contains(defining, i):
+				sources = append(sources, source)
+			}
+		}
+		return sources
+	}
+
+	switch tags.merge {
+	case mergeDeep:
+		for _, i := range defining {
+			for _, key := range collectionKeys(values[i]) {
+				collection.elements[key] = r.mapSources
+			}
+		}
+	case mergeAppend:
+		collection.others = withOnly(-1, nil)
+
+		index := 0
+		for _, i := range slices.Backward(defining) { // starting with the source with the lowest precedence
+			for _, key := range collectionKeys(values[i]) {
+				elem := &collectionElemSource{MapSource: r.mapSources[i], depth: len(parents) + 1, elem: indexTags(key)}
+				collection.elements[strconv.Itoa(index)] = withOnly(i, elem)
+				index++
+			}
+		}
+	default:
+		collection.others = withOnly(defining[0], r.mapSources[defining[0]])
+		for _, key := range collectionKeys(values[defining[0]]) {
+			collection.elements[key] = collection.others
+		}
+	}
+
+	return collection
+}
+
+// collectionKeys returns the keys of the elements of the given array or table, which are indices for arrays, in order.
+// Returns nil if the value is no collection, and an empty slice for empty collections.
+func collectionKeys(value any) []string {
+	switch collection := reflect.ValueOf(value); collection.Kind() { //nolint:exhaustive  // other values are no collections
+	case reflect.Map:
+		keys := make([]string, 0, collection.Len())
+		for _, key := range collection.MapKeys() {
+			keys = append(keys, fmt.Sprint(key.Interface()))
+		}
+		slices.Sort(keys)
+		return keys
+	case reflect.Slice:
+		keys := make([]string, collection.Len())
+		for index := range collection.Len() {
+			keys[index] = strconv.Itoa(index)
+		}
+		return keys
+	default:
+		return nil
+	}
+}
+
+// collectionElemSource looks up the fields of an element of a collection of structs in a different element of the
+// collection in the given map source, which is used to concatenate the arrays of tables of multiple config files.
+type collectionElemSource struct {
+	cli.MapSource
+
+	depth int              // position of the element within the parents of its fields
+	elem  *configFieldTags // tags of the element to look up the fields in
+}
+
+func (ces *collectionElemSource) fieldKey(tags *configFieldTags, parents []*configFieldTags) (string, bool) {
+	if len(parents) > ces.depth {
+		parents = slices.Clone(parents)
+		parents[ces.depth] = ces.elem
+	}
+
+	return mapSourceKey(ces.MapSource, tags, parents)
+}
+
+// withMapSources runs fn with the given map sources instead of the map sources of the reflector, so that the fields
+// of elements of collections are only looked up in the config files the collection was resolved from.
+func (r *structReflector) withMapSources(sources []cli.MapSource, fn func() error) error {
+	mapSources := r.mapSources
+	r.mapSources = sources
+	defer func() { r.mapSources = mapSources }()
+
+	return fn()
+}
+
+// collectionKey extracts the key of a collection element from the given env var or flag name, which consists of the
+// prefix of the collection, the key and one of the given field names, joined with separator.
+func collectionKey(name string, prefix string, separator string, fieldNames []string) (string, bool) {
+	rest, ok := strings.CutPrefix(name, prefix)
+	if !ok {
+		return "", false
+	}
+
+	for _, fieldName := range fieldNames {
+		if key, ok := strings.CutSuffix(rest, separator+fieldName); ok && key != "" {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+// argFlagNames returns the names of all flags in the given CLI args, without leading dashes and values.
+func argFlagNames(args []string) []string {
+	names := make([]string, 0, len(args))
+
+	for _, arg := range args {
+		if arg == "--" { // all following args are positional
+			break
+		}
+
+		name, ok := strings.CutPrefix(arg, "-")
+		if !ok {
+			continue
+		}
+
+		name, _, _ = strings.Cut(strings.TrimPrefix(name, "-"), "=")
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// structFieldKeys returns the keys of all fields of the given struct type relative to the struct itself, such as its
+// env keys or flag names. Global fields, as well as fields within nested collections, are not included.
+func (r *structReflector) structFieldKeys(structType reflect.Type, parents []string, key func(t *configFieldTags) string, separator string) []string {
+	fieldKeys := make([]string, 0, structType.NumField())
+
+	for i := range structType.NumField() {
+		fieldType := structType.Field(i)
+		if !fieldType.IsExported() {
+			continue
+		}
+
+		tags := parseTagsWithFieldNameDefault(&fieldType.Tag, fieldType.Name)
+		if tags.flag == "-" || key(tags) == "-" || tags.isGlobal {
+			continue
+		}
+
+		nested := slices.Clone(parents)
+		nested = append(nested, key(tags))
+
+		typ := fieldType.Type
+		if typ.Kind() == reflect.Ptr && typ.Elem().Kind() == reflect.Struct && !r.isValueType(typ) {
+			typ = typ.Elem()
+		}
+
+		switch {
+		case r.isValueType(typ):
+			fieldKeys = append(fieldKeys, strings.Join(nested, separator))
+		case typ.Kind() == reflect.Struct:
+			fieldKeys = append(fieldKeys, r.structFieldKeys(typ, nested, key, separator)...)
+		case (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map) && r.isStructElem(typ.Elem()):
+			continue
+		default:
+			fieldKeys = append(fieldKeys, strings.Join(nested, separator))
+		}
+	}
+
+	return fieldKeys
+}
+
+// newStructElem initializes the given collection element if it is a nil pointer, and returns a pointer to the struct
+// it holds, so that it can be recursed into.
+func newStructElem(elem reflect.Value) any {
+	if elem.Kind() == reflect.Ptr {
+		elem.Set(reflect.New(elem.Type().Elem()))
+		return elem.Interface()
+	}
+
+	return elem.Addr().Interface()
+}
+
+// keyTags returns the tags of a synthetic parent for the instance with the given key of a map, so that the fields of
+// the instance are named e.g. databases-primary-host, DATABASES_PRIMARY_HOST and databases.primary.host.
+func keyTags(key string) *configFieldTags {
+	return &configFieldTags{
+		flag: key,
+		env:  strings.ToUpper(key),
+		toml: key,
+		json: key,
+		yaml: key,
+	}
+}
+
+// indexTags returns the tags of a synthetic parent for the element at the given index of a collection, so that the
+// fields of the element are named e.g. upstream-0-url, UPSTREAM_0_URL and upstream.0.url.
+func indexTags(index string) *configFieldTags {
+	return &configFieldTags{
+		flag: index,
+		env:  index,
+		toml: index,
+		json: index,
+		yaml: index,
+	}
+}
@@ -21,7 +21,17 @@ type structReflector struct {
 	foundFlags []cli.Flag           // flags found in the struct
 	applyFuncs []func(*cli.Command) // functions to call after flags are parsed, to apply values to the struct
 
-	tomlSources []cli.MapSource
+	mapSources            []cli.MapSource // config files, keyed by the tag of their format
+	interpolator          *interpolator   // resolves references to env vars and other fields in values
+	provenanceFields      []*provenanceField
+	precedence            []Source          // order of precedence of sources, unless overridden by the precedence tag
+	envPrefix             string            // prefix of the env vars of all fields, see WithEnvPrefix
+	tomlRoot              string            // dotted key of the table within config files containing the config
+	dotEnv                map[string]string // values loaded from dotenv files, used as fallback for env vars
+	envFiles              *envFiles         // reads values from files referenced by <KEY>_FILE env vars
+	decoders              map[reflect.Type]func(string) (any, error)
+	secretFileEnvVarsOnly bool     // only read secret fields from files referenced by <KEY>_FILE env vars
+	args                  []string // CLI args, if known at reflection time, used to discover elements of collections of structs
 }
 
 func (r *structReflector) Flags() []cli.Flag {
@@ -34,44 +44,159 @@ func (r *structReflector) Apply(command *cli.Command) {
 	}
 }
 
+// reset discards all state recorded while running a command, so that it can be run again.
+func (r *structReflector) reset() {
+	r.interpolator.err = nil
+	r.envFiles.err = nil
+	for _, field := range r.provenanceFields {
+		field.lookedUp = false
+		field.setCount = flagCount(field.flag)
+	}
+}
+
+// lookupErr returns the first error that occurred while looking up values in their sources, which can't return errors
+// themselves.
+func (r *structReflector) lookupErr() error {
+	if r.interpolator.err != nil {
+		return r.interpolator.err
+	}
+
+	return r.envFiles.err
+}
+
+// fieldKey joins the keys of all parents and the field itself using the given separator, unless the field is global,
+// in which case its own key is used as is.
+func fieldKey(tags *configFieldTags, parents []*configFieldTags, key func(t *configFieldTags) string, separator string) string {
+	if tags.isGlobal {
+		return key(tags)
+	}
+
+	keys := lo.Map(parents, func(parent *configFieldTags, _ int) string { return key(parent) })
+	keys = append(keys, key(tags))
+	return strings.Join(keys, separator)
+}
+
 func (r *structReflector) processField(field reflect.StructField, fieldValue reflect.Value, tags *configFieldTags, parents []*configFieldTags) error {
 	if tags == nil || tags.flag == "-" {
 		return nil
 	}
 
-	valueSources := make([]cli.ValueSource, 0)
+	if err := validateMergeStrategy(field, tags); err != nil {
+		return err
+	}
 
-	if tags.toml != "" && tags.toml != "-" && len(r.tomlSources) > 0 { // load from toml file unless explicitly set to "-"
-		tomlKey := tags.toml
-		if !tags.isGlobal {
-			tomlKeys := lo.Map(parents, func(parent *configFieldTags, _ int) string { return parent.toml })
-			tomlKeys = append(tomlKeys, tags.toml)
-			tomlKey = strings.Join(tomlKeys, ".")
-		}
+	precedence, err := r.fieldPrecedence(field, tags)
+	if err != nil {
+		return err
+	}
+
+	// records whether the value of the flag was looked up in its sources, which is only the case if it wasn't set on the CLI
+	provenance := &provenanceField{tags: tags, value: fieldValue, precedence: precedence}
+	valueSources := []cli.ValueSource{&lookupRecorder{field: provenance}}
+
+	// references to other fields are resolved by their toml path, regardless of the format of the config files
+	path := fieldKey(tags, parents, func(t *configFieldTags) string { return t.toml }, ".")
+	reference := &interpolatedField{provenance: provenance, defaultValue: tags.defaultValue, precedence: precedence}
+
+	var fileSource, envSource cli.ValueSource // appended to the value sources in order of precedence
 
-		valueSources = append(valueSources, NewValueSourceFromMaps(tomlKey, r.tomlSources...))
+	if len(r.mapSources) > 0 { // load from config files, unless the tag of their format is explicitly set to "-"
+		files := newFieldValueSource(tags, parents, r.mapSources)
+		reference.file = files
+		provenance.file = files
+		fileSource = r.interpolator.source(path, files)
+		if r.isListType(field.Type) || r.isMapType(field.Type) {
+			// arrays and tables are applied element by element, instead of as comma separated list
+			fileSource = &multiValueSource{interpolator: r.interpolator, path: path, file: files, isMap: r.isMapType(field.Type)}
+		}
 	}
 
 	if tags.env != "-" { // load from env var unless it's explicitly set to "-"
-		envKey := tags.env
-		if !tags.isGlobal {
-			emvKeys := lo.Map(parents, func(parent *configFieldTags, _ int) string { return parent.env })
-			emvKeys = append(emvKeys, tags.env)
-			envKey = strings.Join(emvKeys, "_")
+		var files *envFiles
+		if r.readsEnvFile(tags) {
+			files = r.envFiles
 		}
 
-		valueSources = append(valueSources, cli.EnvVar(envKey))
+		env := newEnvValueSource(r.envKey(tags, parents), r.dotEnv, files)
+		r.envFiles.fieldKeys[env.key] = struct{}{}
+
+		reference.env = env
+		provenance.env = env
+		envSource = env
 	}
 
-	flagName := tags.flag
-	if !tags.isGlobal {
-		flagKeys := lo.Map(parents, func(parent *configFieldTags, _ int) string { return parent.flag })
-		flagKeys = append(flagKeys, tags.flag)
-		flagName = strings.Join(flagKeys, "-")
+	for _, source := range precedence {
+		switch {
+		case source == SourceFiles && fileSource != nil:
+			valueSources = append(valueSources, fileSource)
+		case source == SourceEnv && envSource != nil:
+			valueSources = append(valueSources, envSource)
+		}
 	}
 
+	flagTags := tags
+	if hasReferences(tags.defaultValue) {
+		// default values with references can't be parsed before all fields are known, so they are looked up instead
+		valueSources = append(valueSources, r.interpolator.source(path, &defaultValueSource{value: tags.defaultValue}))
+
+		withoutDefault := *tags
+		withoutDefault.defaultValue = ""
+		flagTags = &withoutDefault
+	}
+
+	if tags.toml != "-" {
+		r.interpolator.fields[path] = reference
+	}
+
+	flagName := fieldKey(tags, parents, func(t *configFieldTags) string { return t.flag }, "-")
+
 	sources := cli.NewValueSourceChain(valueSources...)
 
+	flag, apply, err := r.newFlag(field, fieldValue, flagTags, flagName, sources)
+	if err != nil {
+		return err
+	}
+
+	if flagTags != tags {
+		setDefaultText(flag, tags.defaultValue)
+	}
+
+	reference.flag = flag
+
+	provenance.path = path
+	provenance.flagName = flagName
+	provenance.flag = flag
+	provenance.dotEnv = r.dotEnv
+	provenance.interpolator = r.interpolator
+
+	r.foundFlags = append(r.foundFlags, flag)
+	r.applyFuncs = append(r.applyFuncs, apply)
+	r.provenanceFields = append(r.provenanceFields, provenance)
+
+	return nil
+}
+
+// readsEnvFile returns whether the value of the given field can be read from a file referenced by a <KEY>_FILE env var.
+func (r *structReflector) readsEnvFile(tags *configFieldTags) bool {
+	return tags.isSecret || !r.secretFileEnvVarsOnly
+}
+
+// newFlag creates a flag for the given field, as well as a function to apply the parsed flag value to the field.
+func (r *structReflector) newFlag(field reflect.StructField, fieldValue reflect.Value, tags *configFieldTags, flagName string, sources cli.ValueSourceChain) (cli.Flag, func(*cli.Command), error) {
+	_, hasDecoder := r.decoders[field.Type]
+
+	switch {
+	case !hasDecoder && field.Type == timeType:
+		return timeFlag(field, fieldValue, tags, flagName, sources)
+	case !hasDecoder && field.Type == locationType:
+		return stringBackedFlag(field, fieldValue, tags, flagName, sources, parseLocation)
+	case hasDecoder || isTextUnmarshaler(field.Type):
+		// types with a registered decoder, or that know how to parse themselves take precedence over their kind
+		return stringBackedFlag(field, fieldValue, tags, flagName, sources, func(value string) (reflect.Value, error) {
+			return r.parseValue(field.Type, value)
+		})
+	}
+
 	var (
 		flag  cli.Flag
 		apply func(*cli.Command)
@@ -96,7 +221,7 @@ func (r *structReflector) processField(field reflect.StructField, fieldValue ref
 		if tags.defaultValue != "" {
 			valueParsed, err := strconv.ParseInt(tags.defaultValue, 10, strconv.IntSize)
 			if err != nil {
-				return fmt.Errorf("failed to parse int value %s for field %s: %w", tags.defaultValue, field.Name, err)
+				return nil, nil, fmt.Errorf("failed to parse int value %s for field %s: %w", tags.defaultValue, field.Name, err)
 			}
 			value = int(valueParsed)
 		}
@@ -118,7 +243,7 @@ func (r *structReflector) processField(field reflect.StructField, fieldValue ref
 		if tags.defaultValue != "" {
 			valueParsed, err := strconv.ParseInt(tags.defaultValue, 10, 8)
 			if err != nil {
-				return fmt.Errorf("failed to parse int value %s for field %s: %w", tags.defaultValue, field.Name, err)
+				return nil, nil, fmt.Errorf("failed to parse int value %s for field %s: %w", tags.defaultValue, field.Name, err)
 			}
 
 			value = int8(valueParsed)
@@ -141,7 +266,7 @@ func (r *structReflector) processField(field reflect.StructField, fieldValue ref
 		if tags.defaultValue != "" {
 			valueParsed, err := strconv.ParseInt(tags.defaultValue, 10, 16)
 			if err != nil {
-				return fmt.Errorf("failed to parse int value %s for field %s: %w", tags.defaultValue, field.Name, err)
+				return nil, nil, fmt.Errorf("failed to parse int value %s for field %s: %w", tags.defaultValue, field.Name, err)
 			}
 
 			value = int16(valueParsed)
@@ -164,7 +289,7 @@ func (r *structReflector) processField(field reflect.StructField, fieldValue ref
 		if tags.defaultValue != "" {
 			valueParsed, err := strconv.ParseInt(tags.defaultValue, 10, 32)
 			if err != nil {
-				return fmt.Errorf("failed to parse int value %s for field %s: %w", tags.defaultValue, field.Name, err)
+				return nil, nil, fmt.Errorf("failed to parse int value %s for field %s: %w", tags.defaultValue, field.Name, err)
 			}
 
 			value = int32(valueParsed)
@@ -191,7 +316,7 @@ func (r *structReflector) processField(field reflect.StructField, fieldValue ref
 			if tags.defaultValue != "" {
 				value, err = time.ParseDuration(tags.defaultValue)
 				if err != nil {
-					return fmt.Errorf("failed to parse duration %s for field %s: %w", tags.defaultValue, field.Name, err)
+					return nil, nil, fmt.Errorf("failed to parse duration %s for field %s: %w", tags.defaultValue, field.Name, err)
 				}
 			}
 
@@ -215,7 +340,7 @@ func (r *structReflector) processField(field reflect.StructField, fieldValue ref
 			if tags.defaultValue != "" {
 				value, err = strconv.ParseInt(tags.defaultValue, 10, 64)
 				if err != nil {
-					return fmt.Errorf("failed to parse int value %s for field %s: %w", tags.defaultValue, field.Name, err)
+					return nil, nil, fmt.Errorf("failed to parse int value %s for field %s: %w", tags.defaultValue, field.Name, err)
 				}
 			}
 
@@ -240,7 +365,7 @@ func (r *structReflector) processField(field reflect.StructField, fieldValue ref
 		if tags.defaultValue != "" {
 			value, err = strconv.ParseUint(tags.defaultValue, 10, strconv.IntSize)
 			if err != nil {
-				return fmt.Errorf("failed to parse uint value %s for field %s: %w", tags.defaultValue, field.Name, err)
+				return nil, nil, fmt.Errorf("failed to parse uint value %s for field %s: %w", tags.defaultValue, field.Name, err)
 			}
 		}
 
@@ -261,7 +386,7 @@ func (r *structReflector) processField(field reflect.StructField, fieldValue ref
 		if tags.defaultValue != "" {
 			valueParsed, err := strconv.ParseUint(tags.defaultValue, 10, 8)
 			if err != nil {
-				return fmt.Errorf("failed to parse uint value %s for field %s: %w", tags.defaultValue, field.Name, err)
+				return nil, nil, fmt.Errorf("failed to parse uint value %s for field %s: %w", tags.defaultValue, field.Name, err)
 			}
 
 			value = uint8(valueParsed)
@@ -284,7 +409,7 @@ func (r *structReflector) processField(field reflect.StructField, fieldValue ref
 		if tags.defaultValue != "" {
 			valueParsed, err := strconv.ParseUint(tags.defaultValue, 10, 16)
 			if err != nil {
-				return fmt.Errorf("failed to parse uint value %s for field %s: %w", tags.defaultValue, field.Name, err)
+				return nil, nil, fmt.Errorf("failed to parse uint value %s for field %s: %w", tags.defaultValue, field.Name, err)
 			}
 
 			value = uint16(valueParsed)
@@ -307,7 +432,7 @@ func (r *structReflector) processField(field reflect.StructField, fieldValue ref
 		if tags.defaultValue != "" {
 			valueParsed, err := strconv.ParseUint(tags.defaultValue, 10, 32)
 			if err != nil {
-				return fmt.Errorf("failed to parse uint value %s for field %s: %w", tags.defaultValue, field.Name, err)
+				return nil, nil, fmt.Errorf("failed to parse uint value %s for field %s: %w", tags.defaultValue, field.Name, err)
 			}
 
 			value = uint32(valueParsed)
@@ -333,7 +458,7 @@ func (r *structReflector) processField(field reflect.StructField, fieldValue ref
 		if tags.defaultValue != "" {
 			value, err = strconv.ParseUint(tags.defaultValue, 10, 64)
 			if err != nil {
-				return fmt.Errorf("failed to parse uint value %s for field %s: %w", tags.defaultValue, field.Name, err)
+				return nil, nil, fmt.Errorf("failed to parse uint value %s for field %s: %w", tags.defaultValue, field.Name, err)
 			}
 		}
 
@@ -354,7 +479,7 @@ func (r *structReflector) processField(field reflect.StructField, fieldValue ref
 		if tags.defaultValue != "" {
 			valueParsed, err := strconv.ParseFloat(tags.defaultValue, 32)
 			if err != nil {
-				return fmt.Errorf("failed to parse float value %s for field %s: %w", tags.defaultValue, field.Name, err)
+				return nil, nil, fmt.Errorf("failed to parse float value %s for field %s: %w", tags.defaultValue, field.Name, err)
 			}
 
 			value = float32(valueParsed)
@@ -380,7 +505,7 @@ func (r *structReflector) processField(field reflect.StructField, fieldValue ref
 		if tags.defaultValue != "" {
 			value, err = strconv.ParseFloat(tags.defaultValue, 64)
 			if err != nil {
-				return fmt.Errorf("failed to parse float value %s for field %s: %w", tags.defaultValue, field.Name, err)
+				return nil, nil, fmt.Errorf("failed to parse float value %s for field %s: %w", tags.defaultValue, field.Name, err)
 			}
 		}
 
@@ -404,7 +529,7 @@ func (r *structReflector) processField(field reflect.StructField, fieldValue ref
 		if tags.defaultValue != "" {
 			value, err = strconv.ParseBool(tags.defaultValue)
 			if err != nil {
-				return fmt.Errorf("failed to parse bool value %s for field %s: %w", tags.defaultValue, field.Name, err)
+				return nil, nil, fmt.Errorf("failed to parse bool value %s for field %s: %w", tags.defaultValue, field.Name, err)
 			}
 		}
 
@@ -419,14 +544,138 @@ func (r *structReflector) processField(field reflect.StructField, fieldValue ref
 		apply = func(cmd *cli.Command) {
 			fieldValue.SetBool(cmd.Bool(flagName))
 		}
+	case reflect.Slice:
+		return r.sliceFlag(field, fieldValue, tags, flagName, sources)
+	case reflect.Map:
+		return r.mapFlag(field, fieldValue, tags, flagName, sources)
+	case reflect.Ptr:
+		return r.pointerFlag(field, fieldValue, tags, flagName, sources)
 	default:
-		return fmt.Errorf("unknown field type %s", field.Type.Kind())
+		return nil, nil, fmt.Errorf("unknown field type %s", field.Type.Kind())
 	}
 
-	r.foundFlags = append(r.foundFlags, flag)
-	r.applyFuncs = append(r.applyFuncs, apply)
+	return flag, apply, nil
+}
 
-	return nil
+// pointerFlag creates a flag for a pointer field, such as *int or *string, which allows distinguishing
+// between a value that was not set at all and its zero value.
+//
+// The field remains nil unless a value is provided by any source, including a default value.
+func (r *structReflector) pointerFlag(field reflect.StructField, fieldValue reflect.Value, tags *configFieldTags, flagName string, sources cli.ValueSourceChain) (cli.Flag, func(*cli.Command), error) {
+	elemField := field
+	elemField.Type = field.Type.Elem()
+	elemValue := reflect.New(elemField.Type).Elem() // the flag value is applied to this, before we point the field to it
+
+	flag, applyElem, err := r.newFlag(elemField, elemValue, tags, flagName, sources)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if tags.defaultValue == "" { // the field remains nil, instead of defaulting to the zero value of its type
+		setDefaultText(flag, "")
+	}
+
+	apply := func(cmd *cli.Command) {
+		if !cmd.IsSet(flagName) && tags.defaultValue == "" {
+			fieldValue.SetZero()
+			return
+		}
+
+		applyElem(cmd)
+
+		pointer := reflect.New(elemField.Type)
+		pointer.Elem().Set(elemValue)
+		fieldValue.Set(pointer)
+	}
+
+	return flag, apply, nil
+}
+
+// stringBackedFlag creates a string flag for a field whose value is parsed using the given parse function.
+//
+// The default value is parsed at reflection time, and values from other sources are validated when the flag is set,
+// so that errors are reported early. The actual field value is then parsed when it is applied to the struct.
+func stringBackedFlag(field reflect.StructField, fieldValue reflect.Value, tags *configFieldTags, flagName string, sources cli.ValueSourceChain, parse func(string) (reflect.Value, error)) (cli.Flag, func(*cli.Command), error) {
+	if tags.defaultValue != "" {
+		if _, err := parse(tags.defaultValue); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s value %s for field %s: %w", field.Type, tags.defaultValue, field.Name, err)
+		}
+	}
+
+	flag := &cli.StringFlag{
+		Name:        flagName,
+		Aliases:     tags.aliases,
+		Usage:       tags.help,
+		DefaultText: tags.defaultValue,
+		Value:       tags.defaultValue,
+		Sources:     sources,
+		Validator: func(value string) error {
+			if value == "" { // empty values result in the zero value of the field
+				return nil
+			}
+			_, err := parse(value)
+			return err
+		},
+	}
+
+	apply := func(cmd *cli.Command) {
+		value := cmd.String(flagName)
+		if value == "" {
+			fieldValue.SetZero()
+			return
+		}
+
+		// the value has already been validated when the flag was set, so we can ignore the error here
+		parsed, _ := parse(value)
+		fieldValue.Set(parsed)
+	}
+
+	return flag, apply, nil
+}
+
+// isValueType returns whether fields of the given struct (or pointer to struct) type are configured as a single
+// value, instead of recursing into the fields of the struct.
+func (r *structReflector) isValueType(typ reflect.Type) bool {
+	if _, ok := r.decoders[typ]; ok {
+		return true
+	}
+
+	if typ.Kind() == reflect.Ptr {
+		return typ == locationType || isTextUnmarshaler(typ.Elem())
+	}
+
+	return isTextUnmarshaler(typ)
+}
+
+// parseValue parses a string into a value of the given type, using a registered decoder for the type if there is one.
+func (r *structReflector) parseValue(typ reflect.Type, value string) (reflect.Value, error) {
+	if decode, ok := r.decoders[typ]; ok {
+		return decodeValue(typ, decode, value)
+	}
+
+	return parseScalar(typ, value)
+}
+
+// decodeValue runs the given decoder, and makes sure the decoded value can be assigned to a value of the given type.
+func decodeValue(typ reflect.Type, decode func(string) (any, error), value string) (reflect.Value, error) {
+	decoded, err := decode(value)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	if decoded == nil {
+		return reflect.Zero(typ), nil
+	}
+
+	decodedValue := reflect.ValueOf(decoded)
+	switch {
+	case decodedValue.Type().AssignableTo(typ):
+		return decodedValue, nil
+	case decodedValue.Type().ConvertibleTo(typ):
+		return decodedValue.Convert(typ), nil
+	default:
+		return reflect.Value{}, fmt.Errorf("decoder for %s returned a value of incompatible type %T", typ, decoded)
+	}
 }
 
 func (r *structReflector) recurseStruct(anyStruct any, parents []*configFieldTags) error {
@@ -446,7 +695,17 @@ func (r *structReflector) recurseStruct(anyStruct any, parents []*configFieldTag
 		nested := slices.Clone(parents)
 		nested = append(nested, tags)
 
-		if fieldType.Type.Kind() == reflect.Struct {
+		isValue := r.isValueType(fieldType.Type)
+
+		if fieldType.Type == configFilesType { // config files are loaded before the struct is reflected
+			continue
+		}
+
+		if err := r.validateIncludeKey(fieldType, tags, parents); err != nil {
+			return err
+		}
+
+		if fieldType.Type.Kind() == reflect.Struct && !isValue {
 			// recurse using the pointer to the nested struct, so we can modify it
 			err := r.recurseStruct(fieldValue.Addr().Interface(), nested)
 			if err != nil {
@@ -456,7 +715,7 @@ func (r *structReflector) recurseStruct(anyStruct any, parents []*configFieldTag
 			continue
 		}
 
-		if fieldType.Type.Kind() == reflect.Ptr && fieldType.Type.Elem().Kind() == reflect.Struct {
+		if fieldType.Type.Kind() == reflect.Ptr && fieldType.Type.Elem().Kind() == reflect.Struct && !isValue {
 			if fieldValue.IsNil() {
 				fieldValue.Set(reflect.New(fieldType.Type.Elem()))
 			}
@@ -469,6 +728,24 @@ func (r *structReflector) recurseStruct(anyStruct any, parents []*configFieldTag
 			continue
 		}
 
+		if fieldType.Type.Kind() == reflect.Slice && !isValue && r.isStructElem(fieldType.Type.Elem()) {
+			err := r.recurseStructSlice(fieldType, fieldValue, tags, parents)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if fieldType.Type.Kind() == reflect.Map && !isValue && r.isStructElem(fieldType.Type.Elem()) {
+			err := r.recurseStructMap(fieldType, fieldValue, tags, parents)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
 		err := r.processField(fieldType, fieldValue, tags, parents)
 		if err != nil {
 			return err
@@ -478,14 +755,63 @@ func (r *structReflector) recurseStruct(anyStruct any, parents []*configFieldTag
 	return nil
 }
 
-func NewStructConfigurator(anyStruct any, tomlSources []cli.MapSource) (StructReflector, error) {
+func NewStructConfigurator(anyStruct any, mapSources []cli.MapSource, opts ...Option) (StructReflector, error) {
+	reflector, err := newStructReflector(anyStruct, mapSources, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return reflector, nil
+}
+
+// newStructReflector creates the flags for all fields of the given struct, see NewStructConfigurator.
+func newStructReflector(anyStruct any, mapSources []cli.MapSource, opts ...Option) (*structReflector, error) {
+	cfg := newOptions(opts)
+
+	dotEnv, err := loadDotEnvFiles(cfg.requiredDotEnvFiles, cfg.dotEnvFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	fileSources, loadedFiles, err := loadConfigFiles(cfg.configFiles, cfg.configSearchPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, files := range cfg.loadedConfigFiles {
+		*files = loadedFiles
+	}
+
+	dirSources, err := loadConfigDirs(cfg.configDirs)
+	if err != nil {
+		return nil, err
+	}
+
+	precedence := defaultPrecedence
+	if cfg.precedence != nil {
+		precedence, err = normalizePrecedence(cfg.precedence)
+		if err != nil {
+			return nil, fmt.Errorf("invalid precedence: %w", err)
+		}
+	}
+
 	reflector := &structReflector{
-		foundFlags:  make([]cli.Flag, 0),
-		applyFuncs:  make([]func(*cli.Command), 0),
-		tomlSources: tomlSources,
+		foundFlags:   make([]cli.Flag, 0),
+		applyFuncs:   make([]func(*cli.Command), 0),
+		mapSources:   applyEnvPrefix(applyProfile(applyRoot(slices.Concat(mapSources, fileSources, dirSources), cfg.tomlRoot), activeProfile(cfg, dotEnv)), cfg.envPrefix),
+		interpolator: newInterpolator(dotEnv),
+		envFiles:     newEnvFiles(),
+		precedence:   precedence,
+		envPrefix:    cfg.envPrefix,
+		tomlRoot:     cfg.tomlRoot,
+		decoders:     cfg.decoders,
+		args:         cfg.args,
+		dotEnv:       dotEnv,
+
+		secretFileEnvVarsOnly: cfg.secretFileEnvVarsOnly,
 	}
 
-	err := reflector.recurseStruct(anyStruct, nil)
+	err = reflector.recurseStruct(anyStruct, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,130 @@
+package structconf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// DirectoryKeyFormat defines how the names of the files in a directory source map to config fields.
+type DirectoryKeyFormat int
+
+const (
+	// DirectoryKeysEnv names files by the env var of a field, e.g. DATABASE_PASSWORD
+	DirectoryKeysEnv DirectoryKeyFormat = iota
+	// DirectoryKeysFlag names files by the flag of a field, e.g. database-password
+	DirectoryKeysFlag
+	// DirectoryKeysToml names files by the dotted toml path of a field, e.g. database.password
+	DirectoryKeysToml
+)
+
+// directorySource is a map source reading the value of every key from a file with the same name in a directory,
+// such as a Kubernetes ConfigMap or Secret mounted as volume.
+type directorySource struct {
+	dir       string
+	keyFormat DirectoryKeyFormat
+	envPrefix string // prefix of the file names for DirectoryKeysEnv, see WithEnvPrefix
+}
+
+// NewDirectorySource creates a map source which reads values from the files in the given directory, with one file per
+// field, named according to the given key format. A trailing newline in the files is ignored.
+func NewDirectorySource(dir string, keyFormat DirectoryKeyFormat) (cli.MapSource, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %q: %w", dir, err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("failed to read directory %q: not a directory", dir)
+	}
+
+	return &directorySource{
+		dir:       dir,
+		keyFormat: keyFormat,
+	}, nil
+}
+
+func (ds *directorySource) String() string { return fmt.Sprintf("directory source %[1]q", ds.dir) }
+func (ds *directorySource) GoString() string {
+	return fmt.Sprintf("&directorySource{dir:%[1]q}", ds.dir)
+}
+
+func (ds *directorySource) Lookup(name string) (any, bool) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") { // don't escape the directory
+		return nil, false
+	}
+
+	data, err := os.ReadFile(filepath.Join(ds.dir, name))
+	if err != nil {
+		return nil, false
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), true
+}
+
+func (ds *directorySource) fieldKey(tags *configFieldTags, parents []*configFieldTags) (string, bool) {
+	var (
+		keyTag    func(t *configFieldTags) string
+		separator string
+	)
+
+	switch ds.keyFormat {
+	case DirectoryKeysEnv:
+		keyTag, separator = func(t *configFieldTags) string { return t.env }, "_"
+	case DirectoryKeysFlag:
+		keyTag, separator = func(t *configFieldTags) string { return t.flag }, "-"
+	case DirectoryKeysToml:
+		keyTag, separator = func(t *configFieldTags) string { return t.toml }, "."
+	default:
+		return "", false
+	}
+
+	if key := keyTag(tags); key == "" || key == "-" {
+		return "", false
+	}
+
+	if ds.keyFormat == DirectoryKeysEnv { // files are named like the actual env vars, including their prefix
+		return prefixedEnvKey(ds.envPrefix, tags, parents), true
+	}
+
+	return fieldKey(tags, parents, keyTag, separator), true
+}
+
+func (ds *directorySource) withEnvPrefix(prefix string) cli.MapSource {
+	if ds.keyFormat != DirectoryKeysEnv {
+		return ds
+	}
+
+	prefixed := *ds
+	prefixed.envPrefix = prefix
+	return &prefixed
+}
+
+// configDir is a directory source configured by the WithConfigDir option.
+type configDir struct {
+	dir       string
+	keyFormat DirectoryKeyFormat
+}
+
+// loadConfigDirs creates directory sources for the given directories, skipping directories that don't exist.
+func loadConfigDirs(dirs []configDir) ([]cli.MapSource, error) {
+	sources := make([]cli.MapSource, 0, len(dirs))
+
+	for _, dir := range dirs {
+		source, err := NewDirectorySource(dir.dir, dir.keyFormat)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
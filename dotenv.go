@@ -0,0 +1,198 @@
+package structconf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadDotEnvFiles loads the given dotenv files, with earlier files taking precedence over later ones. Required files
+// take precedence over optional ones, which are skipped if they don't exist.
+func loadDotEnvFiles(required []string, optional []string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	load := func(file string, mustExist bool) error {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			if !mustExist && errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("failed to read file %q: %w", file, err)
+		}
+
+		parsed, err := parseDotEnv(string(data), func(key string) (string, bool) {
+			if value, ok := os.LookupEnv(key); ok {
+				return value, true
+			}
+			value, ok := values[key]
+			return value, ok
+		})
+		if err != nil {
+			return fmt.Errorf("failed to parse file as dotenv %q: %w", file, err)
+		}
+
+		for key, value := range parsed {
+			if _, ok := values[key]; !ok { // earlier files take precedence
+				values[key] = value
+			}
+		}
+
+		return nil
+	}
+
+	for _, file := range required {
+		if err := load(file, true); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, file := range optional {
+		if err := load(file, false); err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+// parseDotEnv parses the contents of a dotenv file.
+//
+// Every line is a KEY=value assignment, optionally prefixed by export. Empty lines and lines starting with # are
+// ignored. Values are either single quoted (taken literally), double quoted (supporting the escape sequences \n, \r,
+// \t, \", \\ and \$) or unquoted, in which case a # preceded by whitespace starts a comment. References to other
+// variables, such as ${VAR} or $VAR, are expanded in double quoted and unquoted values, using the variables defined
+// earlier in the same file, or the given lookup function. Undefined variables expand to an empty string.
+func parseDotEnv(data string, lookup func(key string) (string, bool)) (map[string]string, error) {
+	values := make(map[string]string)
+	expand := func(key string) string {
+		if value, ok := values[key]; ok {
+			return value
+		}
+		value, _ := lookup(key)
+		return value
+	}
+
+	for i, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(line, "export"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			line = strings.TrimSpace(rest)
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing separator %q", i+1, "=")
+		}
+
+		key = strings.TrimSpace(key)
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", i+1, key)
+		}
+
+		parsed, err := parseDotEnvValue(strings.TrimSpace(value), expand)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		values[key] = parsed
+	}
+
+	return values, nil
+}
+
+// parseDotEnvValue parses a single, possibly quoted value of a dotenv file.
+func parseDotEnvValue(value string, expand func(key string) string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	quote := value[0]
+	if quote != '\'' && quote != '"' {
+		// unquoted values end at the first comment
+		for i := 1; i < len(value); i++ {
+			if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+				value = strings.TrimSpace(value[:i])
+				break
+			}
+		}
+
+		return expandVariables(value, false, expand)
+	}
+
+	end := -1
+	for i := 1; i < len(value); i++ {
+		if value[i] == '\\' && quote == '"' {
+			i++ // skip the escaped character
+			continue
+		}
+		if value[i] == quote {
+			end = i
+			break
+		}
+	}
+
+	if end < 0 {
+		return "", fmt.Errorf("unterminated quoted value %s", value)
+	}
+
+	if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected characters %q after quoted value", rest)
+	}
+
+	if quote == '\'' {
+		return value[1:end], nil
+	}
+
+	return expandVariables(value[1:end], true, expand)
+}
+
+// expandVariables replaces references to variables in the given value, such as ${VAR} or $VAR. If escapes is set,
+// backslash escape sequences are resolved as well, which allows writing a literal $ as \$.
+func expandVariables(value string, escapes bool, expand func(key string) string) (string, error) {
+	expanded := &strings.Builder{}
+
+	for i := 0; i < len(value); i++ {
+		switch {
+		case escapes && value[i] == '\\' && i+1 < len(value):
+			i++
+			switch value[i] {
+			case 'n':
+				expanded.WriteByte('\n')
+			case 'r':
+				expanded.WriteByte('\r')
+			case 't':
+				expanded.WriteByte('\t')
+			default: // \", \\, \$ and unknown escape sequences are written as the escaped character
+				expanded.WriteByte(value[i])
+			}
+		case value[i] == '$' && i+1 < len(value) && value[i+1] == '{':
+			end := strings.IndexByte(value[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable reference %s", value[i:])
+			}
+
+			expanded.WriteString(expand(value[i+2 : i+end]))
+			i += end
+		case value[i] == '$' && i+1 < len(value) && isVariableNameChar(value[i+1]):
+			end := i + 1
+			for end < len(value) && isVariableNameChar(value[end]) {
+				end++
+			}
+
+			expanded.WriteString(expand(value[i+1 : end]))
+			i = end - 1
+		default:
+			expanded.WriteByte(value[i])
+		}
+	}
+
+	return expanded.String(), nil
+}
+
+func isVariableNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
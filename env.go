@@ -0,0 +1,150 @@
+package structconf
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// envFileSuffix is appended to the env key of a field to read its value from a file instead, which is a common
+// convention for mounted secrets, e.g. DATABASE_PASSWORD_FILE=/run/secrets/db_pw.
+const envFileSuffix = "_FILE"
+
+// envValueSource looks up a value from an env var, falling back to the values loaded from dotenv files. Like the
+// sources created by cli.EnvVar, it implements cli.EnvValueSource so that the env var is shown in the help text.
+type envValueSource struct {
+	key    string
+	dotEnv map[string]string
+	files  *envFiles // reads the value from the file referenced by the <KEY>_FILE env var, nil if not supported
+}
+
+// newEnvValueSource creates a value source for the given env var. If files is set, and the env var itself is not set,
+// the value is read from the file referenced by the <KEY>_FILE env var instead.
+func newEnvValueSource(key string, dotEnv map[string]string, files *envFiles) *envValueSource {
+	return &envValueSource{
+		key:    key,
+		dotEnv: dotEnv,
+		files:  files,
+	}
+}
+
+func (e *envValueSource) Lookup() (string, bool) {
+	if value, ok := lookupEnv(e.key, e.dotEnv); ok {
+		return value, true
+	}
+
+	if e.files != nil {
+		return e.files.read(e.key, e.dotEnv)
+	}
+
+	return "", false
+}
+
+func (e *envValueSource) IsFromEnv() bool {
+	return true
+}
+
+func (e *envValueSource) Key() string {
+	return e.key
+}
+
+func (e *envValueSource) String() string { return fmt.Sprintf("environment variable %[1]q", e.key) }
+func (e *envValueSource) GoString() string {
+	return fmt.Sprintf("&envValueSource{Key:%[1]q}", e.key)
+}
+
+// envFiles reads values of fields from files referenced by <KEY>_FILE env vars. Files are only read once a value is
+// looked up, so that they are ignored if the env var itself is set.
+type envFiles struct {
+	fieldKeys map[string]struct{} // env keys of all fields, which are never treated as reference to a file
+	err       error               // the first error that occurred while reading a file
+}
+
+func newEnvFiles() *envFiles {
+	return &envFiles{fieldKeys: make(map[string]struct{})}
+}
+
+// isFileKey returns whether the given env var may reference a file, which is not the case if it is the env var of a
+// field itself, such as LOG_FILE for a field LogFile next to a field Log.
+func (f *envFiles) isFileKey(name string) bool {
+	_, isFieldKey := f.fieldKeys[name]
+	return strings.HasSuffix(name, envFileSuffix) && !isFieldKey
+}
+
+// read returns the contents of the file referenced by the <KEY>_FILE env var for the given key, without a trailing
+// newline. Since value sources can't return errors, the first error is recorded, and false is returned.
+func (f *envFiles) read(key string, dotEnv map[string]string) (string, bool) {
+	fileKey := key + envFileSuffix
+	if !f.isFileKey(fileKey) {
+		return "", false
+	}
+
+	file, ok := lookupEnv(fileKey, dotEnv)
+	if !ok {
+		return "", false
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if f.err == nil {
+			f.err = fmt.Errorf("failed to read file %q referenced by env var %s: %w", file, fileKey, err)
+		}
+		return "", false
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), true
+}
+
+// pathListEnvSource looks up a list of paths from an env var, separated by the path list separator of the OS (":" on
+// unix systems), and encodes it using encodeList, so that paths containing commas are kept intact.
+type pathListEnvSource struct {
+	key string
+}
+
+func (p *pathListEnvSource) Lookup() (string, bool) {
+	value, ok := os.LookupEnv(p.key)
+	if !ok {
+		return "", false
+	}
+
+	return encodeList(filepath.SplitList(value)), true
+}
+
+func (p *pathListEnvSource) IsFromEnv() bool {
+	return true
+}
+
+func (p *pathListEnvSource) Key() string {
+	return p.key
+}
+
+func (p *pathListEnvSource) String() string { return fmt.Sprintf("environment variable %[1]q", p.key) }
+func (p *pathListEnvSource) GoString() string {
+	return fmt.Sprintf("&pathListEnvSource{Key:%[1]q}", p.key)
+}
+
+// lookupEnv looks up an env var in the environment of the process, falling back to the values loaded from dotenv files.
+func lookupEnv(key string, dotEnv map[string]string) (string, bool) {
+	if value, ok := os.LookupEnv(key); ok {
+		return value, true
+	}
+
+	value, ok := dotEnv[key]
+	return value, ok
+}
+
+// envNames returns the names of all env vars that are set in the environment of the process or in dotenv files.
+func envNames(dotEnv map[string]string) []string {
+	environ := os.Environ()
+	names := make([]string, 0, len(environ)+len(dotEnv))
+
+	for _, env := range environ {
+		name, _, _ := strings.Cut(env, "=")
+		names = append(names, name)
+	}
+
+	return slices.AppendSeq(names, maps.Keys(dotEnv))
+}
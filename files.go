@@ -0,0 +1,229 @@
+package structconf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// loadConfigFiles loads the given config files, which must exist, followed by all files found at the given search
+// paths, in order of precedence. It returns the sources of the files, as well as the paths of the files that were
+// loaded.
+func loadConfigFiles(required []string, searchPaths []string) ([]cli.MapSource, []string, error) {
+	sources := make([]cli.MapSource, 0, len(required)+len(searchPaths))
+	loaded := make([]string, 0, len(required)+len(searchPaths))
+
+	for _, file := range required {
+		source, err := NewConfigFileSource(file)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sources = append(sources, source)
+		loaded = append(loaded, file)
+	}
+
+	for _, searchPath := range searchPaths {
+		file, err := expandSearchPath(searchPath)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		source, err := NewConfigFileSource(file)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sources = append(sources, source)
+		loaded = append(loaded, file)
+	}
+
+	return sources, loaded, nil
+}
+
+// expandSearchPath expands env vars and a leading ~ in the given config search path. If XDG_CONFIG_HOME is not set, it
+// defaults to the user config directory, as defined by the XDG base directory specification.
+func expandSearchPath(searchPath string) (string, error) {
+	var expandErr error
+
+	expanded := os.Expand(searchPath, func(key string) string {
+		value, ok := os.LookupEnv(key)
+		if !ok && key == "XDG_CONFIG_HOME" {
+			value, expandErr = os.UserConfigDir()
+		}
+		return value
+	})
+	if expandErr != nil {
+		return "", fmt.Errorf("failed to expand config search path %q: %w", searchPath, expandErr)
+	}
+
+	if rest, ok := strings.CutPrefix(expanded, "~"); ok && (rest == "" || rest[0] == '/' || rest[0] == filepath.Separator) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to expand config search path %q: %w", searchPath, err)
+		}
+		expanded = home + rest
+	}
+
+	return expanded, nil
+}
+
+// ConfigFiles can be embedded anywhere in a config struct to add a flag for loading config files, which is equivalent
+// to using the WithLoadConfigFlag option. The name of the flag defaults to load-config, and can be changed using the
+// flag tag of the embedded field. If the env tag is set, config files can also be passed by env var, see
+// WithLoadConfigEnvVar. Example:
+//
+//	type AppConfig struct {
+//		structconf.ConfigFiles `flag:"config" env:"APP_CONFIG" help:"Load configuration from files"`
+//		LogLevel string
+//	}
+type ConfigFiles struct {
+	// LoadedConfigFiles contains the paths of all config files that were loaded, in order of precedence.
+	LoadedConfigFiles []string
+}
+
+var configFilesType = reflect.TypeFor[ConfigFiles]()
+
+// configFilesOptions returns the options equivalent to the first ConfigFiles field found in the given config struct.
+func configFilesOptions(configPointer any) []Option {
+	configFiles, tags, ok := findConfigFiles(reflect.ValueOf(configPointer))
+	if !ok {
+		return nil
+	}
+
+	flagName := tags.flag
+	if flagName == "" {
+		flagName = "load-config"
+	}
+
+	opts := []Option{WithLoadConfigFlag(flagName), WithLoadedConfigFiles(&configFiles.LoadedConfigFiles)}
+	if tags.env != "" && tags.env != "-" {
+		opts = append(opts, WithLoadConfigEnvVar(tags.env))
+	}
+	if tags.help != "" {
+		opts = append(opts, withLoadConfigFlagUsage(tags.help))
+	}
+
+	return opts
+}
+
+// findConfigFiles searches the given struct and all its nested structs for a ConfigFiles field.
+func findConfigFiles(structValue reflect.Value) (*ConfigFiles, *configFieldTags, bool) {
+	structValue = reflect.Indirect(structValue)
+	if structValue.Kind() != reflect.Struct {
+		return nil, nil, false
+	}
+
+	structType := structValue.Type()
+	for i := range structType.NumField() {
+		fieldType := structType.Field(i)
+		fieldValue := structValue.Field(i)
+
+		if fieldType.Type == configFilesType {
+			return fieldValue.Addr().Interface().(*ConfigFiles), parseTags(&fieldType.Tag), true
+		}
+
+		isStruct := fieldType.Type.Kind() == reflect.Struct ||
+			(fieldType.Type.Kind() == reflect.Ptr && fieldType.Type.Elem().Kind() == reflect.Struct && !fieldValue.IsNil())
+		if !fieldType.IsExported() || !isStruct {
+			continue
+		}
+
+		if configFiles, tags, ok := findConfigFiles(fieldValue); ok {
+			return configFiles, tags, true
+		}
+	}
+
+	return nil, nil, false
+}
+
+// lazyConfigFileSource loads the config files passed by flag once it is first looked up. This allows binding a config
+// struct to a command before its flags are parsed.
+type lazyConfigFileSource struct {
+	command  *cli.Command
+	flagName string
+	profile  string
+	root     string
+
+	loaded  bool
+	sources []cli.MapSource
+	files   []string
+	err     error
+}
+
+func (l *lazyConfigFileSource) String() string {
+	return fmt.Sprintf("config files from flag %[1]q", l.flagName)
+}
+
+func (l *lazyConfigFileSource) GoString() string {
+	return fmt.Sprintf("&lazyConfigFileSource{flag:%[1]q}", l.flagName)
+}
+
+func (l *lazyConfigFileSource) Lookup(name string) (any, bool) {
+	for _, source := range l.mapSources() {
+		if value, ok := source.Lookup(name); ok {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+func (l *lazyConfigFileSource) mapSources() []cli.MapSource {
+	sources, _, _ := l.load()
+	return sources
+}
+
+// load loads the config files passed by flag, unless they have already been loaded.
+func (l *lazyConfigFileSource) load() ([]cli.MapSource, []string, error) {
+	if !l.loaded {
+		l.loaded = true
+		l.sources, l.files, l.err = loadConfigFiles(l.configFiles(), nil)
+		l.sources = applyProfile(applyRoot(l.sources, l.root), l.profile)
+	}
+
+	return l.sources, l.files, l.err
+}
+
+// configFiles returns the config files passed by the flag of the command. If the flag isn't set on the command itself,
+// the value of a flag with the same name on the closest parent command which has it set is used, so that config files
+// can be passed to a parent command and are inherited by its subcommands.
+func (l *lazyConfigFileSource) configFiles() []string {
+	for _, command := range l.command.Lineage() {
+		for _, flag := range command.Flags {
+			if slices.Contains(flag.Names(), l.flagName) && flag.IsSet() {
+				return command.StringSlice(l.flagName)
+			}
+		}
+	}
+
+	return l.command.StringSlice(l.flagName)
+}
+
+// withProfile applies the overrides of the given profile to the config files once they are loaded.
+func (l *lazyConfigFileSource) withProfile(profile string) cli.MapSource {
+	l.profile = profile
+	return l
+}
+
+// withRoot reads the values of the config files from the table at the given dotted key once they are loaded.
+func (l *lazyConfigFileSource) withRoot(root string) cli.MapSource {
+	l.root = root
+	return l
+}
+
+// reset discards the loaded config files, so that they are loaded again the next time the command is run.
+func (l *lazyConfigFileSource) reset() {
+	l.loaded = false
+	l.sources, l.files, l.err = nil, nil, nil
+}
@@ -0,0 +1,169 @@
+package structconf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// includeKey is the top-level key of a toml file listing other toml files to include.
+const includeKey = "include"
+
+// loadTomlFile parses the given toml file and resolves its includes.
+//
+// The include key lists paths or glob patterns of other toml files, relative to the directory of the including file.
+// Included files are merged in the listed order, with files matched by a glob pattern sorted by name. Later files take
+// precedence over earlier ones, and the including file takes precedence over all files it includes. Tables are merged
+// recursively, while all other values, including arrays, are replaced as a whole. Patterns without glob characters
+// must match an existing file, while glob patterns may match no file at all.
+//
+// chain contains the files that led to including the given file, which is used to detect include cycles and to
+// report which files led to an invalid file.
+func loadTomlFile(file string, chain []string) (map[string]any, error) {
+	chain = append(slices.Clone(chain), file)
+	if isIncludeCycle(chain) {
+		return nil, fmt.Errorf("include cycle detected: %s", strings.Join(chain, " -> "))
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, includeChainError(chain, fmt.Errorf("failed to read file %q: %w", file, err))
+	}
+
+	values := make(map[string]any)
+	if err := toml.Unmarshal(data, &values); err != nil {
+		return nil, includeChainError(chain, fmt.Errorf("failed to parse file as toml %q: %w", file, err))
+	}
+
+	include, ok := values[includeKey]
+	if !ok {
+		return values, nil
+	}
+	delete(values, includeKey)
+
+	patterns, err := includePatterns(include)
+	if err != nil {
+		return nil, includeChainError(chain, fmt.Errorf("invalid %s in file %q: %w", includeKey, file, err))
+	}
+
+	merged := make(map[string]any)
+	for _, pattern := range patterns {
+		files, err := resolveInclude(filepath.Dir(file), pattern)
+		if err != nil {
+			return nil, includeChainError(chain, fmt.Errorf("invalid %s in file %q: %w", includeKey, file, err))
+		}
+
+		for _, included := range files {
+			includedValues, err := loadTomlFile(included, chain)
+			if err != nil {
+				return nil, err
+			}
+
+			mergeTables(merged, includedValues)
+		}
+	}
+
+	mergeTables(merged, values) // the including file takes precedence over all files it includes
+	return merged, nil
+}
+
+// validateIncludeKey returns an error if the given field is read from the top-level include key of toml files, since
+// the key is reserved for including other files, and the value of the field would be silently ignored. If the config
+// is read from a table given by WithTomlRoot, only the first key of the root is at the top level.
+func (r *structReflector) validateIncludeKey(field reflect.StructField, tags *configFieldTags, parents []*configFieldTags) error {
+	if r.tomlRoot != "" {
+		if root, _, _ := strings.Cut(r.tomlRoot, "."); root == includeKey {
+			return fmt.Errorf("invalid toml root %q, the top-level key %q is reserved for including other toml files", r.tomlRoot, includeKey)
+		}
+		return nil
+	}
+
+	if tags.toml == "-" || tags.flag == "-" { // the field isn't read from config files
+		return nil
+	}
+
+	path := fieldKey(tags, parents, func(t *configFieldTags) string { return t.toml }, ".")
+	if key, _, _ := strings.Cut(path, "."); key == includeKey {
+		return fmt.Errorf("invalid toml key %q for field %s, the top-level key %q is reserved for including other toml files, use the toml tag to choose a different key", path, field.Name, includeKey)
+	}
+
+	return nil
+}
+
+// includePatterns returns the paths or glob patterns listed by the value of an include key, which is either a single
+// string or an array of strings.
+func includePatterns(include any) ([]string, error) {
+	switch include := include.(type) {
+	case string:
+		return []string{include}, nil
+	case []any:
+		patterns := make([]string, 0, len(include))
+		for _, pattern := range include {
+			pattern, ok := pattern.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected an array of strings, got %v", include)
+			}
+			patterns = append(patterns, pattern)
+		}
+		return patterns, nil
+	default:
+		return nil, fmt.Errorf("expected a string or an array of strings, got %v", include)
+	}
+}
+
+// resolveInclude returns the files matched by the given include pattern, relative to the given directory.
+func resolveInclude(dir string, pattern string) ([]string, error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	if len(files) == 0 && !hasGlobMeta(pattern) { // a missing file without glob is most likely a mistake
+		return nil, fmt.Errorf("failed to read file %q: %w", pattern, os.ErrNotExist)
+	}
+
+	return files, nil
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// isIncludeCycle returns whether the last file in the given include chain already occurs earlier in the chain.
+func isIncludeCycle(chain []string) bool {
+	file := absPath(chain[len(chain)-1])
+	for _, parent := range chain[:len(chain)-1] {
+		if absPath(parent) == file {
+			return true
+		}
+	}
+
+	return false
+}
+
+func absPath(file string) string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.Clean(file)
+	}
+	return abs
+}
+
+// includeChainError adds the chain of files that included the file which caused the given error to it, if the file
+// was included by another file.
+func includeChainError(chain []string, err error) error {
+	if len(chain) <= 1 {
+		return err
+	}
+
+	return fmt.Errorf("%w (included by %s)", err, strings.Join(chain[:len(chain)-1], " -> "))
+}
@@ -0,0 +1,209 @@
+package structconf
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// interpolator resolves references such as ${HOME} or ${server.port} in default values and values of config files.
+//
+// A reference is resolved to the value of the config field with the given toml path, e.g. ${server.port}, which is
+// read from CLI flags, config files, env vars or its default value, in the order of precedence of the field.
+// Otherwise, it is resolved to the env var with the given name, e.g. ${HOME}. References are resolved once the CLI args
+// are parsed, when the sources of flags which are not set on the CLI are looked up. A literal ${ is written as $${.
+type interpolator struct {
+	fields map[string]*interpolatedField // fields which can be referenced, by their toml path
+	dotEnv map[string]string
+	err    error // the first error that occurred while resolving references
+}
+
+// interpolatedField holds the sources of the value of a field which can be referenced by other fields.
+type interpolatedField struct {
+	flag         cli.Flag         // the flag of the field, whose value is used if it was set on the CLI
+	provenance   *provenanceField // records whether the flag was set on the CLI
+	file         cli.ValueSource  // values of config files, which may contain references themselves
+	env          cli.ValueSource  // values of env vars, which are used as is
+	defaultValue string           // default value from the field tags, which may contain references itself
+	precedence   []Source         // order of precedence of the sources of the field
+}
+
+func newInterpolator(dotEnv map[string]string) *interpolator {
+	return &interpolator{
+		fields: make(map[string]*interpolatedField),
+		dotEnv: dotEnv,
+	}
+}
+
+// hasReferences returns whether the given value contains references, or escaped references, to resolve.
+func hasReferences(value string) bool {
+	return strings.Contains(value, "${")
+}
+
+// interpolate resolves all references in the given value of the field with the given path.
+func (in *interpolator) interpolate(value string, path []string) (string, error) {
+	interpolated := &strings.Builder{}
+
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			interpolated.WriteString(value)
+			return interpolated.String(), nil
+		}
+
+		if start > 0 && value[start-1] == '$' { // escaped reference, written as $${
+			interpolated.WriteString(value[:start-1] + "${")
+			value = value[start+2:]
+			continue
+		}
+
+		end := strings.IndexByte(value[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference %s in value of %s", value[start:], path[0])
+		}
+
+		resolved, err := in.resolve(value[start+2:start+end], path)
+		if err != nil {
+			return "", err
+		}
+
+		interpolated.WriteString(value[:start] + resolved)
+		value = value[start+end+1:]
+	}
+}
+
+// resolve returns the value of the given reference, which is either the toml path of a config field, or an env var.
+// path contains the fields whose values are being resolved, to detect cycles.
+func (in *interpolator) resolve(reference string, path []string) (string, error) {
+	field, ok := in.fields[reference]
+	if !ok {
+		if value, ok := lookupEnv(reference, in.dotEnv); ok {
+			return value, nil
+		}
+
+		return "", fmt.Errorf("undefined reference ${%s} in value of %s", reference, path[0])
+	}
+
+	if slices.Contains(path, reference) {
+		return "", fmt.Errorf("reference cycle detected: %s -> %s", strings.Join(path, " -> "), reference)
+	}
+	path = append(slices.Clone(path), reference)
+
+	for _, source := range field.precedence {
+		switch {
+		case source == SourceFlags && field.isSetOnCLI():
+			return formatFlagValue(field.flag.Get()), nil
+		case source == SourceFiles && field.file != nil:
+			if value, ok := field.file.Lookup(); ok {
+				return in.interpolate(value, path)
+			}
+		case source == SourceEnv && field.env != nil:
+			if value, ok := field.env.Lookup(); ok {
+				return value, nil
+			}
+		}
+	}
+
+	return in.interpolate(field.defaultValue, path)
+}
+
+// isSetOnCLI returns whether the flag of the field was set on the CLI. Since all CLI args are parsed before the
+// sources of any flag are looked up, the value of the flag is known at that point.
+func (f *interpolatedField) isSetOnCLI() bool {
+	return f.flag != nil && f.provenance.setOnCLI()
+}
+
+// replaceFlag replaces the flag of the fields using the given flag, e.g. by a flag of a bound command which holds the
+// value set on the CLI.
+func (in *interpolator) replaceFlag(flag cli.Flag, replacement cli.Flag) {
+	for _, field := range in.fields {
+		if field.flag == flag {
+			field.flag = replacement
+		}
+	}
+}
+
+// interpolateValue resolves all references in the given value of the field with the given path. Since value sources
+// can't return errors, the first error is recorded, and false is returned.
+func (in *interpolator) interpolateValue(value string, path string) (string, bool) {
+	if !hasReferences(value) {
+		return value, true
+	}
+
+	interpolated, err := in.interpolate(value, []string{path})
+	if err != nil {
+		if in.err == nil {
+			in.err = err
+		}
+		return "", false
+	}
+
+	return interpolated, true
+}
+
+// source returns a value source resolving all references in the values of the given source, which is the source of
+// the field with the given toml path.
+func (in *interpolator) source(path string, source cli.ValueSource) cli.ValueSource {
+	return &interpolatedValueSource{
+		interpolator: in,
+		path:         path,
+		source:       source,
+	}
+}
+
+// interpolatedValueSource resolves references in the values of another value source. Since value sources can't
+// return errors, errors are recorded by the interpolator, and the value is treated as not found.
+type interpolatedValueSource struct {
+	interpolator *interpolator
+	path         string
+	source       cli.ValueSource
+}
+
+func (ivs *interpolatedValueSource) String() string {
+	return fmt.Sprintf("interpolated %[1]s", ivs.source)
+}
+
+func (ivs *interpolatedValueSource) GoString() string {
+	return fmt.Sprintf("&interpolatedValueSource{path:%[1]q, src:%#[2]v}", ivs.path, ivs.source)
+}
+
+func (ivs *interpolatedValueSource) Lookup() (string, bool) {
+	value, ok := ivs.source.Lookup()
+	if !ok {
+		return "", false
+	}
+
+	return ivs.interpolator.interpolateValue(value, ivs.path)
+}
+
+// defaultValueSource returns the default value of a field, which is used as value source instead of the default value
+// of the flag if it contains references, since these can only be resolved once all fields are known.
+type defaultValueSource struct {
+	value string
+}
+
+func (d *defaultValueSource) Lookup() (string, bool) { return d.value, true }
+func (d *defaultValueSource) String() string         { return fmt.Sprintf("default value %[1]q", d.value) }
+func (d *defaultValueSource) GoString() string {
+	return fmt.Sprintf("&defaultValueSource{value:%[1]q}", d.value)
+}
+
+// setDefaultText sets the default value shown in the help text of the given flag, for flags whose default value is
+// provided by a value source instead, or which don't have a default value at all. An empty text hides the default.
+func setDefaultText(flag cli.Flag, text string) {
+	flagValue := reflect.Indirect(reflect.ValueOf(flag))
+	if flagValue.Kind() != reflect.Struct {
+		return
+	}
+
+	if defaultText := flagValue.FieldByName("DefaultText"); defaultText.IsValid() && defaultText.CanSet() && defaultText.Kind() == reflect.String {
+		defaultText.SetString(text)
+	}
+
+	if hideDefault := flagValue.FieldByName("HideDefault"); hideDefault.IsValid() && hideDefault.CanSet() && hideDefault.Kind() == reflect.Bool {
+		hideDefault.SetBool(text == "")
+	}
+}
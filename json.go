@@ -0,0 +1,29 @@
+package structconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v3"
+)
+
+// NewJSONFileSource loads the given json file as map source. Keys in the file are derived from the json tag of the
+// config fields, which defaults to lower camel case.
+func NewJSONFileSource(name string, file string) (cli.MapSource, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %q: %w", file, err)
+	}
+
+	container := make(map[string]any)
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // keep numbers as written, large integers would otherwise be formatted in exponent notation
+	if err := decoder.Decode(&container); err != nil {
+		return nil, fmt.Errorf("failed to parse file as json %q: %w", file, err)
+	}
+
+	return newTaggedMapSource(name, file, container, func(t *configFieldTags) string { return t.json }), nil
+}
@@ -0,0 +1,91 @@
+package structconf
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// mapFlag creates a flag for a map field with string keys, such as map[string]string or map[string]float64.
+//
+// Map entries are passed as key=value pairs, either by repeating the flag or as a comma separated list - which
+// is also the format expected for default values and env vars. In config files, maps are specified as tables, whose
+// entries are applied as is.
+func (r *structReflector) mapFlag(field reflect.StructField, fieldValue reflect.Value, tags *configFieldTags, flagName string, sources cli.ValueSourceChain) (cli.Flag, func(*cli.Command), error) {
+	if field.Type.Key().Kind() != reflect.String {
+		return nil, nil, fmt.Errorf("unsupported map key type %s for field %s, only string keys are supported", field.Type.Key().Kind(), field.Name)
+	}
+
+	value, err := parseDefaultMap(tags.defaultValue)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse map value %s for field %s: %w", tags.defaultValue, field.Name, err)
+	}
+
+	parse := r.elemParser(field.Type.Elem(), tags)
+
+	// make sure the default values are valid already at reflection time
+	if _, err := parseMapElements(field.Type, value, parse); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse map value %s for field %s: %w", tags.defaultValue, field.Name, err)
+	}
+
+	flag := &stringMapFlag{
+		Name:        flagName,
+		Aliases:     tags.aliases,
+		Usage:       tags.help,
+		DefaultText: tags.defaultValue,
+		Value:       value,
+		Sources:     sources,
+		Validator: func(values map[string]string) error {
+			_, err := parseMapElements(field.Type, values, parse)
+			return err
+		},
+	}
+
+	apply := func(cmd *cli.Command) {
+		// the values have already been validated when the flag was set, so we can ignore the error here
+		parsed, _ := parseMapElements(field.Type, cmd.StringMap(flagName), parse)
+		fieldValue.Set(parsed)
+	}
+
+	return flag, apply, nil
+}
+
+// parseDefaultMap parses a comma separated list of key=value pairs.
+func parseDefaultMap(defaultValue string) (map[string]string, error) {
+	if defaultValue == "" {
+		return nil, nil //nolint:nilnil  // no default value is not an error
+	}
+
+	values := make(map[string]string)
+	for _, item := range splitList(defaultValue) {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("item %q is missing separator %q", item, "=")
+		}
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	return values, nil
+}
+
+// parseMapElements parses the values of the given string map into a map of the given type using parse.
+// Empty maps result in a nil map.
+func parseMapElements(mapType reflect.Type, values map[string]string, parse func(string) (reflect.Value, error)) (reflect.Value, error) {
+	if len(values) == 0 {
+		return reflect.Zero(mapType), nil
+	}
+
+	parsed := reflect.MakeMapWithSize(mapType, len(values))
+	for key, value := range values {
+		elem, err := parse(value)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid value for key %q: %w", key, err)
+		}
+
+		parsed.SetMapIndex(reflect.ValueOf(key).Convert(mapType.Key()), elem)
+	}
+
+	return parsed, nil
+}
@@ -4,14 +4,18 @@ import (
 	"fmt"
 	"log/slog"
 	"reflect"
+	"slices"
+	"strconv"
 	"time"
 )
 
-func MarshalAsMap(configPointer any) (map[string]any, error) {
+func MarshalAsMap(configPointer any, opts ...Option) (map[string]any, error) {
+	cfg := newOptions(opts)
+
 	marshalled := make(map[string]any)
 	err := marshalStruct(configPointer, marshalled, func(t *configFieldTags) string {
 		return t.flag // kebab case
-	})
+	}, cfg.encoders)
 	if err != nil {
 		return nil, err
 	}
@@ -19,8 +23,8 @@ func MarshalAsMap(configPointer any) (map[string]any, error) {
 	return marshalled, nil
 }
 
-func MarshalAsSlogDict(configPointer any, groupName string) (slog.Attr, error) {
-	asMap, err := MarshalAsMap(configPointer)
+func MarshalAsSlogDict(configPointer any, groupName string, opts ...Option) (slog.Attr, error) {
+	asMap, err := MarshalAsMap(configPointer, opts...)
 	if err != nil {
 		return slog.Attr{}, err
 	}
@@ -28,7 +32,7 @@ func MarshalAsSlogDict(configPointer any, groupName string) (slog.Attr, error) {
 	return slog.Group(groupName, attrs...), nil
 }
 
-func marshalStruct(anyStruct any, into map[string]any, nameFromTags func(t *configFieldTags) string) error {
+func marshalStruct(anyStruct any, into map[string]any, nameFromTags func(t *configFieldTags) string, encoders map[reflect.Type]func(any) (string, error)) error {
 	structType := reflect.TypeOf(anyStruct)
 	structValues := reflect.ValueOf(anyStruct)
 
@@ -52,24 +56,30 @@ func marshalStruct(anyStruct any, into map[string]any, nameFromTags func(t *conf
 			continue
 		}
 
-		if fieldType.Type.Kind() == reflect.Struct {
+		if fieldType.Type == configFilesType { // not part of the configuration itself
+			continue
+		}
+
+		isValue := isMarshalValueType(fieldType.Type, encoders)
+
+		if fieldType.Type.Kind() == reflect.Struct && !isValue {
 			// recurse using the pointer to the nested struct, so we can modify it
 			nested := make(map[string]any)
 			into[fieldName] = nested
-			err := marshalStruct(fieldValue.Addr().Interface(), nested, nameFromTags)
+			err := marshalStruct(fieldValue.Addr().Interface(), nested, nameFromTags, encoders)
 			if err != nil {
 				return err
 			}
 			continue
 		}
 
-		if fieldType.Type.Kind() == reflect.Ptr && fieldType.Type.Elem().Kind() == reflect.Struct {
+		if fieldType.Type.Kind() == reflect.Ptr && fieldType.Type.Elem().Kind() == reflect.Struct && !isValue {
 			if fieldValue.IsNil() {
 				fieldValue.Set(reflect.New(fieldType.Type.Elem()))
 			}
 			nested := make(map[string]any)
 			into[fieldName] = nested
-			err := marshalStruct(fieldValue.Interface(), nested, nameFromTags)
+			err := marshalStruct(fieldValue.Interface(), nested, nameFromTags, encoders)
 			if err != nil {
 				return err
 			}
@@ -77,11 +87,42 @@ func marshalStruct(anyStruct any, into map[string]any, nameFromTags func(t *conf
 		}
 
 		if fieldType.Type.Kind() != reflect.Bool && fieldValue.IsZero() {
-			// don't marshal zero values (except for bools which are false)
+			// don't marshal zero values (except for bools which are false), this also skips nil pointers
 			continue
 		}
 
-		value, err := getFieldValue(fieldType, fieldValue, tags)
+		if fieldType.Type.Kind() == reflect.Slice && !isValue && isMarshalStructElem(fieldType.Type.Elem(), encoders) {
+			elements := make([]any, fieldValue.Len())
+			for index := range fieldValue.Len() {
+				element, err := marshalStructElem(fieldValue.Index(index), nameFromTags, encoders)
+				if err != nil {
+					return err
+				}
+				elements[index] = element
+			}
+			into[fieldName] = elements
+			continue
+		}
+
+		if fieldType.Type.Kind() == reflect.Map && !isValue && isMarshalStructElem(fieldType.Type.Elem(), encoders) {
+			instances := make(map[string]any, fieldValue.Len())
+			iter := fieldValue.MapRange()
+			for iter.Next() {
+				// map elements are not addressable, so copy them before marshalling
+				instance := reflect.New(iter.Value().Type()).Elem()
+				instance.Set(iter.Value())
+
+				nested, err := marshalStructElem(instance, nameFromTags, encoders)
+				if err != nil {
+					return err
+				}
+				instances[iter.Key().String()] = nested
+			}
+			into[fieldName] = instances
+			continue
+		}
+
+		value, err := getFieldValue(fieldValue, tags, encoders)
 		if err != nil {
 			return err
 		}
@@ -91,8 +132,72 @@ func marshalStruct(anyStruct any, into map[string]any, nameFromTags func(t *conf
 	return nil
 }
 
-func getFieldValue(field reflect.StructField, fieldValue reflect.Value, tags *configFieldTags) (any, error) {
-	switch field.Type.Kind() { //nolint:exhaustive  // we have a default: clause that results in an error
+// isMarshalStructElem returns whether elements of a collection of the given type are structs (or pointers to
+// structs) which are marshalled as nested maps.
+func isMarshalStructElem(elemType reflect.Type, encoders map[reflect.Type]func(any) (string, error)) bool {
+	if isMarshalValueType(elemType, encoders) {
+		return false
+	}
+
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+
+	return elemType.Kind() == reflect.Struct
+}
+
+// marshalStructElem marshals a single addressable struct element of a collection as map. Nil pointers are marshalled as nil.
+func marshalStructElem(elem reflect.Value, nameFromTags func(t *configFieldTags) string, encoders map[reflect.Type]func(any) (string, error)) (any, error) {
+	if elem.Kind() == reflect.Ptr {
+		if elem.IsNil() {
+			return nil, nil //nolint:nilnil  // nil elements are marshalled as nil, which is not an error
+		}
+	} else {
+		elem = elem.Addr()
+	}
+
+	nested := make(map[string]any)
+	if err := marshalStruct(elem.Interface(), nested, nameFromTags, encoders); err != nil {
+		return nil, err
+	}
+
+	return nested, nil
+}
+
+func getFieldValue(fieldValue reflect.Value, tags *configFieldTags, encoders map[reflect.Type]func(any) (string, error)) (any, error) {
+	if encode, ok := encoders[fieldValue.Type()]; ok {
+		text, err := encode(fieldValue.Interface())
+		if err != nil {
+			return nil, err
+		}
+		if tags.isSecret {
+			return redactSecret(text), nil
+		}
+		return text, nil
+	}
+
+	switch value := fieldValue.Interface().(type) {
+	case time.Time:
+		return value.Format(timeLayout(tags)), nil
+	case *time.Location:
+		if value == nil {
+			return nil, nil //nolint:nilnil  // a nil location is marshalled as nil, which is not an error
+		}
+		return value.String(), nil
+	}
+
+	if isTextMarshaler(fieldValue.Type()) {
+		text, err := marshalText(fieldValue)
+		if err != nil {
+			return nil, err
+		}
+		if tags.isSecret {
+			return redactSecret(text), nil
+		}
+		return text, nil
+	}
+
+	switch fieldValue.Kind() { //nolint:exhaustive  // we have a default: clause that results in an error
 	case reflect.String:
 		if tags.isSecret {
 			return redactSecret(fieldValue.String()), nil
@@ -111,18 +216,74 @@ func getFieldValue(field reflect.StructField, fieldValue reflect.Value, tags *co
 		return fieldValue.Float(), nil
 	case reflect.Bool:
 		return fieldValue.Bool(), nil
+	case reflect.Slice:
+		values := make([]any, fieldValue.Len())
+		for i := range fieldValue.Len() {
+			value, err := getFieldValue(fieldValue.Index(i), tags, encoders)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case reflect.Map:
+		values := make(map[string]any, fieldValue.Len())
+		iter := fieldValue.MapRange()
+		for iter.Next() {
+			value, err := getFieldValue(iter.Value(), tags, encoders)
+			if err != nil {
+				return nil, err
+			}
+			values[iter.Key().String()] = value
+		}
+		return values, nil
+	case reflect.Ptr:
+		if fieldValue.IsNil() {
+			return nil, nil //nolint:nilnil  // nil pointers are marshalled as nil, which is not an error
+		}
+		return getFieldValue(fieldValue.Elem(), tags, encoders)
 	default:
-		return nil, fmt.Errorf("unknown field type %s", field.Type.Kind())
+		return nil, fmt.Errorf("unknown field type %s", fieldValue.Kind())
 	}
 }
 
+// isMarshalValueType returns whether fields of the given struct (or pointer to struct) type are marshalled as a single
+// value, instead of recursing into the fields of the struct.
+func isMarshalValueType(typ reflect.Type, encoders map[reflect.Type]func(any) (string, error)) bool {
+	if _, ok := encoders[typ]; ok {
+		return true
+	}
+
+	if typ.Kind() == reflect.Ptr {
+		return typ == locationType || isTextMarshaler(typ.Elem())
+	}
+
+	return isTextMarshaler(typ)
+}
+
 func mapToSlogAttrs(m map[string]any) []any {
 	attrs := make([]any, 0, len(m))
 	for key, value := range m {
-		if nested, ok := value.(map[string]any); ok {
-			nestedAttrs := mapToSlogAttrs(nested)
+		switch value := value.(type) {
+		case map[string]any:
+			nestedAttrs := mapToSlogAttrs(value)
 			attrs = append(attrs, slog.Group(key, nestedAttrs...))
-		} else {
+		case []any:
+			isStructList := slices.ContainsFunc(value, func(element any) bool {
+				_, ok := element.(map[string]any)
+				return ok
+			})
+			if isStructList {
+				// lists of structs are logged as groups keyed by the index of each element
+				elements := make(map[string]any, len(value))
+				for index, element := range value {
+					elements[strconv.Itoa(index)] = element
+				}
+				attrs = append(attrs, slog.Group(key, mapToSlogAttrs(elements)...))
+				continue
+			}
+			attrs = append(attrs, slog.Any(key, value))
+		default:
 			attrs = append(attrs, slog.String(key, fmt.Sprintf("%v", value)))
 		}
 	}
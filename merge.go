@@ -0,0 +1,100 @@
+package structconf
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+)
+
+// Strategies for merging the values of a field from multiple config files, set by the merge tag of the field.
+const (
+	// mergeReplace uses the value of the config file with the highest precedence, which is the default.
+	mergeReplace = "replace"
+	// mergeAppend concatenates the arrays of all config files, starting with the one with the lowest precedence.
+	mergeAppend = "append"
+	// mergeDeep merges the tables of all config files recursively, with the highest precedence winning for each key.
+	mergeDeep = "deep"
+)
+
+// validateMergeStrategy makes sure the merge tag of the given field is a known strategy applicable to its type.
+func validateMergeStrategy(field reflect.StructField, tags *configFieldTags) error {
+	switch tags.merge {
+	case "", mergeReplace:
+		return nil
+	case mergeAppend:
+		if field.Type.Kind() != reflect.Slice {
+			return fmt.Errorf("merge strategy %q for field %s is only supported for slices", tags.merge, field.Name)
+		}
+	case mergeDeep:
+		if field.Type.Kind() != reflect.Map {
+			return fmt.Errorf("merge strategy %q for field %s is only supported for maps", tags.merge, field.Name)
+		}
+	default:
+		return fmt.Errorf("invalid merge strategy %q for field %s, expected one of %q, %q or %q", tags.merge, field.Name, mergeReplace, mergeAppend, mergeDeep)
+	}
+
+	return nil
+}
+
+// mergeValues merges the values of a field found in multiple config files, ordered by precedence, using the given
+// strategy.
+func mergeValues(values []any, strategy string) any {
+	switch strategy {
+	case mergeAppend:
+		merged := make([]any, 0, len(values))
+		for i := len(values) - 1; i >= 0; i-- {
+			if list, ok := values[i].([]any); ok {
+				merged = append(merged, list...)
+			} else {
+				merged = append(merged, values[i])
+			}
+		}
+		return merged
+	case mergeDeep:
+		merged := make(map[string]any)
+		for i := len(values) - 1; i >= 0; i-- {
+			table, ok := asTable(values[i])
+			if !ok { // values which aren't tables can't be merged
+				return values[0]
+			}
+			mergeTables(merged, table)
+		}
+		return merged
+	default:
+		return values[0]
+	}
+}
+
+// asTable converts the given value to a table with string keys, if it is a map.
+func asTable(value any) (map[string]any, bool) {
+	switch value := value.(type) {
+	case map[string]any:
+		return value, true
+	case map[any]any:
+		table := make(map[string]any, len(value))
+		for key, v := range value {
+			table[fmt.Sprint(key)] = v
+		}
+		return table, true
+	default:
+		return nil, false
+	}
+}
+
+// mergeTables merges the values of src into dst, overriding existing values in dst. Tables contained in both are
+// merged recursively.
+func mergeTables(dst map[string]any, src map[string]any) {
+	for key, value := range src {
+		srcTable, srcIsTable := value.(map[string]any)
+		dstTable, dstIsTable := dst[key].(map[string]any)
+
+		if srcIsTable && dstIsTable {
+			merged := maps.Clone(dstTable)
+			mergeTables(merged, srcTable)
+			dst[key] = merged
+			continue
+		}
+
+		dst[key] = value
+	}
+}
@@ -0,0 +1,271 @@
+package structconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// encodedValuePrefix marks values of list and map flags which are encoded as json instead of a comma separated list, so
+// that elements containing commas, such as the elements of arrays and tables in config files, are kept intact. It
+// starts with a NUL byte, which can't occur in CLI args or env vars.
+const encodedValuePrefix = "\x00json:"
+
+// encodeList encodes the given elements as value of a list flag, which is set to exactly these elements.
+func encodeList(elements []string) string {
+	encoded, _ := json.Marshal(elements) // marshalling a slice of strings can't fail
+	return encodedValuePrefix + string(encoded)
+}
+
+// encodeMap encodes the given entries as value of a map flag, which is set to exactly these entries.
+func encodeMap(entries map[string]string) string {
+	encoded, _ := json.Marshal(entries) // marshalling a map of strings can't fail
+	return encodedValuePrefix + string(encoded)
+}
+
+// stringListFlag is a string slice flag, which accepts lists encoded by encodeList in addition to comma separated
+// lists.
+type stringListFlag = cli.FlagBase[[]string, cli.NoConfig, stringList]
+
+// stringList is the value of a stringListFlag.
+type stringList struct {
+	elements   *[]string
+	hasBeenSet bool
+}
+
+func (l stringList) Create(value []string, destination *[]string, _ cli.NoConfig) cli.Value {
+	*destination = slices.Clone(value)
+	return &stringList{elements: destination}
+}
+
+func (l stringList) ToString(value []string) string {
+	return strings.Join(value, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	if !l.hasBeenSet { // the first value replaces the default value
+		*l.elements = nil
+		l.hasBeenSet = true
+	}
+
+	if encoded, ok := strings.CutPrefix(value, encodedValuePrefix); ok {
+		var elements []string
+		if err := json.Unmarshal([]byte(encoded), &elements); err != nil {
+			return err
+		}
+
+		*l.elements = append(*l.elements, elements...)
+		return nil
+	}
+
+	*l.elements = append(*l.elements, splitList(value)...)
+	return nil
+}
+
+func (l *stringList) Get() any {
+	return *l.elements
+}
+
+func (l *stringList) String() string {
+	if l.elements == nil {
+		return ""
+	}
+	return strings.Join(*l.elements, ",")
+}
+
+// stringMapFlag is a string map flag, which accepts maps encoded by encodeMap in addition to comma separated lists of
+// key=value pairs.
+type stringMapFlag = cli.FlagBase[map[string]string, cli.NoConfig, stringMap]
+
+// stringMap is the value of a stringMapFlag.
+type stringMap struct {
+	entries    *map[string]string
+	hasBeenSet bool
+}
+
+func (m stringMap) Create(value map[string]string, destination *map[string]string, _ cli.NoConfig) cli.Value {
+	*destination = maps.Clone(value)
+	return &stringMap{entries: destination}
+}
+
+func (m stringMap) ToString(value map[string]string) string {
+	return formatFlagValue(value)
+}
+
+func (m *stringMap) Set(value string) error {
+	if !m.hasBeenSet { // the first value replaces the default value
+		*m.entries = make(map[string]string)
+		m.hasBeenSet = true
+	}
+
+	if encoded, ok := strings.CutPrefix(value, encodedValuePrefix); ok {
+		var entries map[string]string
+		if err := json.Unmarshal([]byte(encoded), &entries); err != nil {
+			return err
+		}
+
+		maps.Copy(*m.entries, entries)
+		return nil
+	}
+
+	for _, item := range splitList(value) {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("item %q is missing separator %q", item, "=")
+		}
+		(*m.entries)[key] = value
+	}
+
+	return nil
+}
+
+func (m *stringMap) Get() any {
+	return *m.entries
+}
+
+func (m *stringMap) String() string {
+	if m.entries == nil {
+		return ""
+	}
+	return formatFlagValue(*m.entries)
+}
+
+// splitList splits a comma separated list into its elements. A comma preceded by a backslash is part of an element
+// instead of a separator, and backslashes preceding a comma are escaped by another backslash, e.g. `a\,b,c\\,d` is
+// split into `a,b`, `c\` and `d`. All other backslashes are kept as is, so that values such as Windows paths don't
+// need to be escaped.
+func splitList(value string) []string {
+	var elements []string
+	element := &strings.Builder{}
+	backslashes := 0
+
+	for _, char := range value {
+		switch char {
+		case '\\':
+			backslashes++
+			continue
+		case ',':
+			element.WriteString(strings.Repeat(`\`, backslashes/2))
+			if backslashes%2 == 1 { // escaped comma
+				element.WriteRune(char)
+			} else {
+				elements = append(elements, element.String())
+				element.Reset()
+			}
+		default:
+			element.WriteString(strings.Repeat(`\`, backslashes))
+			element.WriteRune(char)
+		}
+		backslashes = 0
+	}
+
+	element.WriteString(strings.Repeat(`\`, backslashes))
+	return append(elements, element.String())
+}
+
+// joinList joins the given elements into a comma separated list, escaping commas and backslashes as expected by
+// splitList, so that the list is split into exactly these elements again.
+func joinList(elements []string) string {
+	joined := &strings.Builder{}
+
+	for i, element := range elements {
+		if i > 0 {
+			joined.WriteRune(',')
+		}
+
+		backslashes := 0
+		for _, char := range element {
+			switch char {
+			case '\\':
+				backslashes++
+			case ',':
+				joined.WriteString(strings.Repeat(`\`, backslashes+1))
+				backslashes = 0
+			default:
+				backslashes = 0
+			}
+			joined.WriteRune(char)
+		}
+
+		if i < len(elements)-1 { // trailing backslashes precede the separator
+			joined.WriteString(strings.Repeat(`\`, backslashes))
+		}
+	}
+
+	return joined.String()
+}
+
+// isListType returns whether fields of the given type are set by a list flag, which is the case for slices and
+// pointers to slices, unless they are parsed as single value.
+func (r *structReflector) isListType(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr && !r.isParsedFromText(typ) {
+		typ = typ.Elem()
+	}
+
+	return typ.Kind() == reflect.Slice && !r.isParsedFromText(typ)
+}
+
+// isMapType returns whether fields of the given type are set by a map flag, which is the case for maps and pointers to
+// maps, unless they are parsed as single value.
+func (r *structReflector) isMapType(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr && !r.isParsedFromText(typ) {
+		typ = typ.Elem()
+	}
+
+	return typ.Kind() == reflect.Map && !r.isParsedFromText(typ)
+}
+
+// multiValueSource looks up the value of a slice or map field in config files. Arrays and tables are encoded using
+// encodeList and encodeMap, so that their elements are applied as is, instead of being joined and split again.
+// References in the elements are resolved by the interpolator, like for all other values of config files.
+type multiValueSource struct {
+	interpolator *interpolator
+	path         string
+	file         *fieldValueSource
+	isMap        bool // whether the field is a map, which is read from tables instead of arrays
+}
+
+func (mvs *multiValueSource) String() string {
+	return mvs.file.String()
+}
+
+func (mvs *multiValueSource) GoString() string {
+	return mvs.file.GoString()
+}
+
+func (mvs *multiValueSource) Lookup() (string, bool) {
+	value, ok := mvs.file.lookupValue()
+	if !ok {
+		return "", false
+	}
+
+	if array, ok := value.([]any); ok && !mvs.isMap {
+		elements := make([]string, len(array))
+		for i, element := range array {
+			if elements[i], ok = mvs.interpolator.interpolateValue(formatMapValue(element), mvs.path); !ok {
+				return "", false
+			}
+		}
+
+		return encodeList(elements), true
+	}
+
+	if table, ok := asTable(value); ok && mvs.isMap {
+		entries := make(map[string]string, len(table))
+		for key, entry := range table {
+			if entries[key], ok = mvs.interpolator.interpolateValue(formatMapValue(entry), mvs.path); !ok {
+				return "", false
+			}
+		}
+
+		return encodeMap(entries), true
+	}
+
+	// other values, such as a comma separated string, are used like values of env vars
+	return mvs.interpolator.interpolateValue(formatMapValue(value), mvs.path)
+}
@@ -0,0 +1,64 @@
+package structconf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// defaultPrecedence is the order of precedence of sources, unless changed by WithPrecedence or the precedence tag.
+var defaultPrecedence = []Source{SourceFlags, SourceFiles, SourceEnv, SourceDefaults}
+
+// normalizePrecedence validates the given order of precedence of sources, and returns it with flags and default values
+// added if they are omitted.
+//
+// Flags always take precedence over all other sources, since the sources of a flag are only looked up if it isn't set
+// on the CLI, and default values are only used if no other source defines a value. So only the order of config files
+// and env vars can be changed, and flags and default values may be omitted.
+func normalizePrecedence(sources []Source) ([]Source, error) {
+	for i, source := range sources {
+		if !slices.Contains(defaultPrecedence, source) {
+			return nil, fmt.Errorf("unknown source %q", source)
+		}
+		if slices.Contains(sources[:i], source) {
+			return nil, fmt.Errorf("duplicate source %q", source)
+		}
+		if source == SourceFlags && i != 0 {
+			return nil, errors.New("flags must take precedence over all other sources")
+		}
+		if source == SourceDefaults && i != len(sources)-1 {
+			return nil, errors.New("default values must not take precedence over any other source")
+		}
+	}
+
+	if !slices.Contains(sources, SourceFiles) || !slices.Contains(sources, SourceEnv) {
+		return nil, fmt.Errorf("the order of %q and %q must be given", SourceFiles, SourceEnv)
+	}
+
+	normalized := slices.DeleteFunc(slices.Clone(sources), func(source Source) bool {
+		return source == SourceFlags || source == SourceDefaults
+	})
+	return slices.Concat([]Source{SourceFlags}, normalized, []Source{SourceDefaults}), nil
+}
+
+// fieldPrecedence returns the order of precedence of sources for the given field, which is set by its precedence tag,
+// e.g. `precedence:"env,file"`, or otherwise by WithPrecedence.
+func (r *structReflector) fieldPrecedence(field reflect.StructField, tags *configFieldTags) ([]Source, error) {
+	if tags.precedence == "" {
+		return r.precedence, nil
+	}
+
+	sources := make([]Source, 0)
+	for source := range strings.SplitSeq(tags.precedence, ",") {
+		sources = append(sources, Source(strings.TrimSpace(source)))
+	}
+
+	precedence, err := normalizePrecedence(sources)
+	if err != nil {
+		return nil, fmt.Errorf("invalid precedence %q for field %s: %w", tags.precedence, field.Name, err)
+	}
+
+	return precedence, nil
+}
@@ -0,0 +1,119 @@
+package structconf
+
+import (
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// envKey returns the name of the env var of the given field, prefixed by the prefix set by WithEnvPrefix. Fields
+// tagged with `envprefix:"false"` are not prefixed, which for fields that aren't global includes all fields nested
+// within a struct tagged this way.
+func (r *structReflector) envKey(tags *configFieldTags, parents []*configFieldTags) string {
+	return prefixedEnvKey(r.envPrefix, tags, parents)
+}
+
+// prefixedEnvKey returns the name of the env var of the given field, prefixed by the given prefix unless the field
+// opted out of it, see envKey.
+func prefixedEnvKey(prefix string, tags *configFieldTags, parents []*configFieldTags) string {
+	key := fieldKey(tags, parents, func(t *configFieldTags) string { return t.env }, "_")
+	if prefix == "" || tags.noEnvPrefix {
+		return key
+	}
+
+	if !tags.isGlobal {
+		for _, parent := range parents {
+			if parent.noEnvPrefix {
+				return key
+			}
+		}
+	}
+
+	return prefix + "_" + key
+}
+
+// envPrefixSource is a map source keyed by the env vars of fields, which therefore supports the prefix set by
+// WithEnvPrefix.
+type envPrefixSource interface {
+	cli.MapSource
+
+	// withEnvPrefix returns the source with the given prefix applied to the env vars its keys are derived from.
+	withEnvPrefix(prefix string) cli.MapSource
+}
+
+// applyEnvPrefix applies the given env var prefix to all sources supporting it.
+func applyEnvPrefix(sources []cli.MapSource, prefix string) []cli.MapSource {
+	if prefix == "" {
+		return sources
+	}
+
+	applied := make([]cli.MapSource, len(sources))
+	for i, source := range sources {
+		if withPrefix, ok := source.(envPrefixSource); ok {
+			applied[i] = withPrefix.withEnvPrefix(prefix)
+		} else {
+			applied[i] = source
+		}
+	}
+
+	return applied
+}
+
+// rootSource is a map source which supports reading values from a table within it, instead of its top-level values.
+type rootSource interface {
+	cli.MapSource
+
+	// withRoot returns the source with the values of the table at the given dotted key as top-level values.
+	withRoot(root string) cli.MapSource
+}
+
+// applyRoot reads the values of all sources supporting it from the table at the given dotted key.
+func applyRoot(sources []cli.MapSource, root string) []cli.MapSource {
+	if root == "" {
+		return sources
+	}
+
+	applied := make([]cli.MapSource, len(sources))
+	for i, source := range sources {
+		if withRoot, ok := source.(rootSource); ok {
+			applied[i] = withRoot.withRoot(root)
+		} else {
+			applied[i] = source
+		}
+	}
+
+	return applied
+}
+
+// withRoot returns a copy of the map source, containing only the values of the table at the given dotted key. If the
+// source doesn't contain the table, the copy is empty.
+func (ms *mapSource) withRoot(root string) cli.MapSource {
+	values, _ := ms.Lookup(root)
+	table, _ := asTable(values)
+
+	container := make(map[any]any, len(table))
+	for k, v := range table {
+		container[k] = v
+	}
+
+	return &mapSource{
+		name:   ms.name,
+		file:   ms.file,
+		m:      container,
+		keyTag: ms.keyTag,
+	}
+}
+
+// nestInRoot nests the given values within the table at the given dotted key, the counterpart to applyRoot.
+func nestInRoot(values map[string]any, root string) map[string]any {
+	if root == "" {
+		return values
+	}
+
+	sections := strings.Split(root, ".")
+	for i := len(sections) - 1; i >= 0; i-- {
+		values = map[string]any{sections[i]: values}
+	}
+
+	return values
+}
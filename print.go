@@ -0,0 +1,153 @@
+package structconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli/v3"
+)
+
+// formats supported by the flag added by WithPrintConfigFlag
+const (
+	printFormatToml  = "toml"
+	printFormatJSON  = "json"
+	printFormatEnv   = "env"
+	printFormatTable = "table"
+)
+
+var printFormats = []string{printFormatToml, printFormatJSON, printFormatEnv, printFormatTable}
+
+// newPrintConfigFlag creates the flag for printing the resolved config configured by WithPrintConfigFlag.
+func newPrintConfigFlag(cfg *options) *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:  cfg.printConfigFlagName,
+		Usage: fmt.Sprintf("Print the resolved configuration as %s and exit", strings.Join(printFormats, ", ")),
+		Validator: func(format string) error {
+			if !slices.Contains(printFormats, format) {
+				return fmt.Errorf("invalid format %q, expected one of %s", format, strings.Join(printFormats, ", "))
+			}
+			return nil
+		},
+	}
+}
+
+// printConfig formats the given config in the given format, once the flags of the given command are applied to it.
+// Values of secret fields are redacted.
+func (r *structReflector) printConfig(configPointer any, cmd *cli.Command, format string, encoders map[reflect.Type]func(any) (string, error)) (string, error) {
+	switch format {
+	case printFormatToml:
+		marshalled := make(map[string]any)
+		if err := marshalStruct(configPointer, marshalled, func(t *configFieldTags) string { return t.toml }, encoders); err != nil {
+			return "", err
+		}
+
+		printed := &bytes.Buffer{}
+		if err := toml.NewEncoder(printed).Encode(nestInRoot(marshalled, r.tomlRoot)); err != nil {
+			return "", fmt.Errorf("failed to format config as toml: %w", err)
+		}
+		return printed.String(), nil
+	case printFormatJSON:
+		marshalled := make(map[string]any)
+		if err := marshalStruct(configPointer, marshalled, func(t *configFieldTags) string { return t.json }, encoders); err != nil {
+			return "", err
+		}
+
+		printed, err := json.MarshalIndent(nestInRoot(marshalled, r.tomlRoot), "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to format config as json: %w", err)
+		}
+		return string(printed) + "\n", nil
+	case printFormatEnv:
+		return r.printEnv(encoders)
+	case printFormatTable:
+		return r.printTable(cmd, encoders)
+	default:
+		return "", fmt.Errorf("invalid format %q, expected one of %s", format, strings.Join(printFormats, ", "))
+	}
+}
+
+// printEnv formats the config as dotenv file, with one line per field that can be set by env var and has a value.
+func (r *structReflector) printEnv(encoders map[reflect.Type]func(any) (string, error)) (string, error) {
+	printed := &strings.Builder{}
+
+	for _, field := range r.provenanceFields {
+		if field.env == nil {
+			continue
+		}
+
+		value, ok, err := field.formatValue(encoders, formatEnvValue)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			fmt.Fprintf(printed, "%s=%s\n", field.env.key, quoteDotEnvValue(value))
+		}
+	}
+
+	return printed.String(), nil
+}
+
+// printTable formats the config as table, with one row per field listing its value and the source it was loaded from.
+func (r *structReflector) printTable(cmd *cli.Command, encoders map[reflect.Type]func(any) (string, error)) (string, error) {
+	printed := &strings.Builder{}
+	table := tabwriter.NewWriter(printed, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "FIELD\tVALUE\tSOURCE")
+
+	for _, field := range r.provenanceFields {
+		value, _, err := field.formatValue(encoders, formatFlagValue)
+		if err != nil {
+			return "", err
+		}
+
+		source := "not set"
+		if provenance := field.provenance(cmd); provenance.Value != nil {
+			source = provenance.Value.origin()
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%s\n", field.path, value, source)
+	}
+
+	if err := table.Flush(); err != nil {
+		return "", err
+	}
+
+	return printed.String(), nil
+}
+
+// formatValue formats the resolved value of the field using format. It returns false for zero values, except for
+// bools, like they are skipped when marshalling a config.
+func (f *provenanceField) formatValue(encoders map[reflect.Type]func(any) (string, error), format func(any) string) (string, bool, error) {
+	if f.value.Kind() != reflect.Bool && f.value.IsZero() {
+		return "", false, nil
+	}
+
+	value, err := getFieldValue(f.value, f.tags, encoders)
+	if err != nil {
+		return "", false, err
+	}
+	if value == nil {
+		return "", false, nil
+	}
+
+	return format(value), true, nil
+}
+
+// quoteDotEnvValue quotes the given value if needed, so that it is parsed as is from a dotenv file.
+func quoteDotEnvValue(value string) string {
+	if !strings.ContainsAny(value, " \t\r\n#'\"$\\") {
+		return value
+	}
+
+	if !strings.ContainsAny(value, "'\r\n") { // single quoted values are used as is
+		return "'" + value + "'"
+	}
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`)
+	return `"` + replacer.Replace(value) + `"`
+}
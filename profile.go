@@ -0,0 +1,78 @@
+package structconf
+
+import (
+	"github.com/urfave/cli/v3"
+)
+
+// profilesKey is the top-level key of a config file containing the overrides of each profile, e.g. [profiles.staging].
+const profilesKey = "profiles"
+
+// profileSource is a map source which supports layering the overrides of a profile over its values.
+type profileSource interface {
+	cli.MapSource
+
+	// withProfile returns the source with the overrides of the given profile applied.
+	withProfile(profile string) cli.MapSource
+}
+
+// activeProfile returns the profile selected by flag, env var or the WithProfile option, in that order of precedence.
+func activeProfile(cfg *options, dotEnv map[string]string) string {
+	if cfg.selectedProfile != "" {
+		return cfg.selectedProfile
+	}
+
+	if cfg.profileEnvVar != "" {
+		if profile, ok := lookupEnv(cfg.profileEnvVar, dotEnv); ok && profile != "" {
+			return profile
+		}
+	}
+
+	return cfg.profile
+}
+
+// applyProfile applies the overrides of the given profile to all sources supporting profiles.
+func applyProfile(sources []cli.MapSource, profile string) []cli.MapSource {
+	if profile == "" {
+		return sources
+	}
+
+	applied := make([]cli.MapSource, len(sources))
+	for i, source := range sources {
+		if withProfile, ok := source.(profileSource); ok {
+			applied[i] = withProfile.withProfile(profile)
+		} else {
+			applied[i] = source
+		}
+	}
+
+	return applied
+}
+
+// withProfile returns a copy of the map source, with the table of the given profile within the profiles table merged
+// into its top-level values. Sources not defining the profile are returned as is.
+func (ms *mapSource) withProfile(profile string) cli.MapSource {
+	profiles, ok := asTable(ms.m[profilesKey])
+	if !ok {
+		return ms
+	}
+
+	overrides, ok := asTable(profiles[profile])
+	if !ok {
+		return ms
+	}
+
+	merged, _ := asTable(ms.m)
+	mergeTables(merged, overrides)
+
+	container := make(map[any]any, len(merged))
+	for k, v := range merged {
+		container[k] = v
+	}
+
+	return &mapSource{
+		name:   ms.name,
+		file:   ms.file,
+		m:      container,
+		keyTag: ms.keyTag,
+	}
+}
@@ -0,0 +1,334 @@
+package structconf
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// Source is a kind of source config values are loaded from.
+type Source string
+
+const (
+	// SourceFlags are CLI flags
+	SourceFlags Source = "flag"
+	// SourceEnv are env vars, including values loaded from dotenv files or files referenced by <KEY>_FILE env vars
+	SourceEnv Source = "env"
+	// SourceFiles are config files and directories
+	SourceFiles Source = "file"
+	// SourceDefaults are the default values defined in the field tags
+	SourceDefaults Source = "default"
+)
+
+// SourceValue is the value of a config field defined by a single source.
+type SourceValue struct {
+	Source Source
+	// Name identifies the source within its kind: the name of the flag or env var, or the path of the config file
+	// or directory. It is empty for default values and values merged from multiple config files.
+	Name string
+	// Key is the key of the field within the config file or directory, and empty for all other sources.
+	Key string
+	// Value is the value as defined by the source, with references to env vars and other fields resolved. Values of
+	// secret fields are redacted.
+	Value string
+	// Merged contains the values of all config files which were merged into the value, for fields with the merge tag
+	// set to "append" or "deep", in order of precedence.
+	Merged []SourceValue
+}
+
+func (v SourceValue) String() string {
+	return fmt.Sprintf("%s (%s)", v.Value, v.origin())
+}
+
+// origin describes the source of the value, e.g. "flag --port" or "file config.toml, key port".
+func (v SourceValue) origin() string {
+	switch {
+	case v.Source == SourceFlags:
+		return "flag --" + v.Name
+	case len(v.Merged) > 0:
+		names := make([]string, len(v.Merged))
+		for i, merged := range v.Merged {
+			names[i] = merged.Name
+		}
+		return fmt.Sprintf("merged from %ss %s", v.Source, strings.Join(names, ", "))
+	case v.Key != "":
+		return fmt.Sprintf("%s %s, key %s", v.Source, v.Name, v.Key)
+	case v.Name != "":
+		return fmt.Sprintf("%s %s", v.Source, v.Name)
+	default:
+		return string(v.Source)
+	}
+}
+
+// FieldProvenance describes where the value of a config field was loaded from.
+type FieldProvenance struct {
+	// Path is the dotted toml path of the field, e.g. server.port
+	Path string
+	// Flag is the name of the flag of the field, e.g. server-port
+	Flag string
+	// Value is the source the value of the field was loaded from, or nil if no source defines a value for the field.
+	Value *SourceValue
+	// Shadowed contains the values of all other sources defining a value for the field, in order of precedence.
+	Shadowed []SourceValue
+}
+
+// ProvenanceReport describes where the values of all config fields were loaded from, see WithProvenance.
+type ProvenanceReport struct {
+	Fields []FieldProvenance
+}
+
+// Field returns the provenance of the field with the given dotted toml path, e.g. server.port.
+func (p *ProvenanceReport) Field(path string) (FieldProvenance, bool) {
+	for _, field := range p.Fields {
+		if field.Path == path {
+			return field, true
+		}
+	}
+
+	return FieldProvenance{}, false
+}
+
+// String formats the report with one line per field, followed by an indented line for each shadowed value.
+func (p *ProvenanceReport) String() string {
+	report := &strings.Builder{}
+
+	for _, field := range p.Fields {
+		if field.Value == nil {
+			fmt.Fprintf(report, "%s: not set\n", field.Path)
+			continue
+		}
+
+		fmt.Fprintf(report, "%s = %s\n", field.Path, field.Value)
+		for _, shadowed := range field.Shadowed {
+			fmt.Fprintf(report, "    shadowed: %s\n", shadowed)
+		}
+	}
+
+	return report.String()
+}
+
+// provenanceField holds the sources of a single config field, to report where its value was loaded from.
+type provenanceField struct {
+	path       string
+	flagName   string
+	tags       *configFieldTags
+	value      reflect.Value     // the field itself, to print its resolved value
+	precedence []Source          // order of precedence of the sources of the field
+	file       *fieldValueSource // nil if there are no config files
+	env        *envValueSource   // nil if the field can't be set by env var
+	dotEnv     map[string]string
+
+	interpolator *interpolator // resolves references in values of config files and default values
+
+	flag     cli.Flag // the flag of the field, or the flag of a bound command holding the value set on the CLI
+	setCount int      // how often the flag was set before the current run of its command, see setOnCLI
+	lookedUp bool     // whether the sources of the flag were looked up, which is only the case if it wasn't set on the CLI
+}
+
+// setOnCLI returns whether the flag of the field was set on the CLI in the current run of its command. Flags keep
+// their state across runs of a command, so the flag must have been set since the end of the previous run, and its
+// sources must not have been looked up.
+func (f *provenanceField) setOnCLI() bool {
+	return f.flag != nil && flagCount(f.flag) > f.setCount && !f.lookedUp
+}
+
+// flagCount returns how often the given flag was set, by the CLI or by its sources, over all runs of its command.
+func flagCount(flag cli.Flag) int {
+	if countable, ok := flag.(cli.Countable); ok {
+		return countable.Count()
+	}
+
+	return 0
+}
+
+// lookupRecorder is the first source of every flag, which records whether the sources of the flag were looked up
+// after parsing the CLI args. It never provides a value itself.
+type lookupRecorder struct {
+	field *provenanceField
+}
+
+func (l *lookupRecorder) Lookup() (string, bool) {
+	l.field.lookedUp = true
+	return "", false
+}
+
+func (l *lookupRecorder) String() string   { return "lookup recorder" }
+func (l *lookupRecorder) GoString() string { return "&lookupRecorder{}" }
+
+// provenance returns the provenance of all config fields, once the flags of the given command are parsed.
+func (r *structReflector) provenance(cmd *cli.Command) ProvenanceReport {
+	report := ProvenanceReport{Fields: make([]FieldProvenance, 0, len(r.provenanceFields))}
+
+	for _, field := range r.provenanceFields {
+		report.Fields = append(report.Fields, field.provenance(cmd))
+	}
+
+	return report
+}
+
+// provenance returns the values of all sources defining the field, in order of precedence.
+func (f *provenanceField) provenance(cmd *cli.Command) FieldProvenance {
+	values := make([]SourceValue, 0)
+
+	for _, source := range f.precedence {
+		switch source {
+		case SourceFlags:
+			if f.setOnCLI() {
+				values = append(values, SourceValue{Source: SourceFlags, Name: f.flagName, Value: formatFlagValue(cmd.Value(f.flagName))})
+			}
+		case SourceFiles:
+			if f.file == nil {
+				continue
+			}
+			fileValues := f.file.sourceValues(f.file.sources)
+			for i := range fileValues {
+				fileValues[i].Value = f.interpolate(fileValues[i].Value)
+			}
+
+			if len(fileValues) > 1 && (f.tags.merge == mergeAppend || f.tags.merge == mergeDeep) {
+				// the values of all config files are merged, instead of shadowing each other
+				merged, _ := f.file.lookupValue()
+				values = append(values, SourceValue{Source: SourceFiles, Value: f.interpolate(formatMapValue(merged)), Merged: fileValues})
+				continue
+			}
+
+			values = append(values, fileValues...)
+		case SourceEnv:
+			if f.env == nil {
+				continue
+			}
+			if value, ok := f.env.Lookup(); ok {
+				name := f.env.key
+				if _, ok := lookupEnv(name, f.dotEnv); !ok { // the value was read from a file referenced by <KEY>_FILE
+					name += envFileSuffix
+				}
+				values = append(values, SourceValue{Source: SourceEnv, Name: name, Value: value})
+			}
+		case SourceDefaults:
+			if f.tags.defaultValue != "" {
+				values = append(values, SourceValue{Source: SourceDefaults, Value: f.interpolate(f.tags.defaultValue)})
+			}
+		}
+	}
+
+	if f.tags.isSecret {
+		for i := range values {
+			values[i].Value = redactSecret(values[i].Value)
+			for j := range values[i].Merged {
+				values[i].Merged[j].Value = redactSecret(values[i].Merged[j].Value)
+			}
+		}
+	}
+
+	provenance := FieldProvenance{Path: f.path, Flag: f.flagName}
+	if len(values) > 0 {
+		provenance.Value = &values[0]
+		provenance.Shadowed = values[1:]
+	}
+
+	return provenance
+}
+
+// interpolate resolves the references in the given value of a config file or default value, like they are resolved
+// when the value is applied. If the references can't be resolved, the value is reported as is.
+func (f *provenanceField) interpolate(value string) string {
+	if f.interpolator == nil || !hasReferences(value) {
+		return value
+	}
+
+	interpolated, err := f.interpolator.interpolate(value, []string{f.path})
+	if err != nil {
+		return value
+	}
+
+	return interpolated
+}
+
+// sourceValues returns the values of the field in all given map sources, in order of precedence.
+func (fvs *fieldValueSource) sourceValues(sources []cli.MapSource) []SourceValue {
+	var values []SourceValue
+
+	for _, source := range sources {
+		if group, ok := source.(mapSourceGroup); ok {
+			values = append(values, fvs.sourceValues(group.mapSources())...)
+			continue
+		}
+
+		key, ok := mapSourceKey(source, fvs.tags, fvs.parents)
+		if !ok {
+			continue
+		}
+
+		if v, ok := source.Lookup(key); ok {
+			values = append(values, SourceValue{Source: SourceFiles, Name: mapSourceName(source), Key: key, Value: formatMapValue(v)})
+		}
+	}
+
+	return values
+}
+
+// mapSourceName returns the path of the config file or directory of the given map source, or its description.
+func mapSourceName(source cli.MapSource) string {
+	switch source := source.(type) {
+	case *mapSource:
+		if source.file != "" {
+			return source.file
+		}
+		return source.name
+	case *directorySource:
+		return source.dir
+	case *collectionElemSource:
+		return mapSourceName(source.MapSource)
+	default:
+		return fmt.Sprint(source)
+	}
+}
+
+// formatFlagValue formats the value of a flag, using the same format as for values of env vars and default values.
+func formatFlagValue(value any) string {
+	if elements, ok := formatElements(value); ok {
+		return strings.Join(elements, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// formatEnvValue formats the value of a flag like formatFlagValue, but escapes commas in the elements of slices and
+// maps, so that the value is parsed into the same elements when it is read from an env var.
+func formatEnvValue(value any) string {
+	if elements, ok := formatElements(value); ok {
+		return joinList(elements)
+	}
+	return fmt.Sprint(value)
+}
+
+// formatElements formats the elements of a slice, or the entries of a map as key=value pairs sorted by key. It
+// returns false for all other values.
+func formatElements(value any) ([]string, bool) {
+	v := reflect.ValueOf(value)
+
+	switch v.Kind() { //nolint:exhaustive  // all other values aren't lists
+	case reflect.Slice:
+		elements := make([]string, v.Len())
+		for i := range v.Len() {
+			elements[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return elements, true
+	case reflect.Map:
+		entries := make(map[string]string, v.Len())
+		for _, key := range v.MapKeys() {
+			entries[fmt.Sprint(key.Interface())] = fmt.Sprint(v.MapIndex(key).Interface())
+		}
+
+		elements := make([]string, 0, len(entries))
+		for _, key := range slices.Sorted(maps.Keys(entries)) {
+			elements = append(elements, key+"="+entries[key])
+		}
+		return elements, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,210 @@
+package structconf
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// sliceFlag creates a flag for a slice field, such as []string or []int.
+//
+// Slice values can be passed by repeating the flag, or as a comma separated list - which is also the format
+// expected for default values and env vars. Arrays in config files are applied element by element. Values are read
+// as strings, validated when the flag is set, and parsed when they are applied to the struct.
+func (r *structReflector) sliceFlag(field reflect.StructField, fieldValue reflect.Value, tags *configFieldTags, flagName string, sources cli.ValueSourceChain) (cli.Flag, func(*cli.Command), error) {
+	elemType := field.Type.Elem()
+
+	if !r.isParsedFromText(elemType) && !isScalarKind(elemType.Kind()) {
+		return nil, nil, fmt.Errorf("unknown slice element type %s for field %s", elemType.Kind(), field.Name)
+	}
+
+	value, err := parseDefaultList[string](field, tags.defaultValue)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parse := r.elemParser(elemType, tags)
+
+	// make sure the default values are valid already at reflection time
+	if _, err := r.parseSliceElements(elemType, value, parse); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s value %s for field %s: %w", elemType.Kind(), tags.defaultValue, field.Name, err)
+	}
+
+	flag := &stringListFlag{
+		Name:        flagName,
+		Aliases:     tags.aliases,
+		Usage:       tags.help,
+		DefaultText: tags.defaultValue,
+		Value:       value,
+		Sources:     sources,
+		Validator: func(values []string) error {
+			_, err := r.parseSliceElements(elemType, values, parse)
+			return err
+		},
+	}
+
+	apply := func(cmd *cli.Command) {
+		// the values have already been validated when the flag was set, so we can ignore the error here
+		parsed, _ := r.parseSliceElements(elemType, cmd.StringSlice(flagName), parse)
+		setSliceValue(fieldValue, parsed)
+	}
+
+	return flag, apply, nil
+}
+
+// elemParser returns the function parsing elements of the given type of a slice or map field. Like for single fields,
+// elements of type time.Time are parsed using the layout specified in the layout tag of the field.
+func (r *structReflector) elemParser(elemType reflect.Type, tags *configFieldTags) func(string) (reflect.Value, error) {
+	if _, hasDecoder := r.decoders[elemType]; !hasDecoder && elemType == timeType {
+		return parseTime(timeLayout(tags))
+	}
+
+	return func(value string) (reflect.Value, error) {
+		return r.parseValue(elemType, value)
+	}
+}
+
+// isParsedFromText returns whether values of the given type are parsed by a registered decoder or by implementing
+// encoding.TextUnmarshaler, instead of by their kind.
+func (r *structReflector) isParsedFromText(typ reflect.Type) bool {
+	_, ok := r.decoders[typ]
+	return ok || isTextUnmarshaler(typ)
+}
+
+// isScalarKind returns whether values of the given kind are parsed by parseScalar.
+func isScalarKind(kind reflect.Kind) bool {
+	switch kind { //nolint:exhaustive  // all other kinds are no scalars
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseDefaultList parses a comma separated list of default values into a slice of the given type.
+func parseDefaultList[T any](field reflect.StructField, defaultValue string) ([]T, error) {
+	if defaultValue == "" {
+		return nil, nil
+	}
+
+	elemType := reflect.TypeFor[T]()
+	parts := splitList(defaultValue)
+	values := make([]T, 0, len(parts))
+
+	for _, part := range parts {
+		value, err := parseScalar(elemType, strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s value %s for field %s: %w", elemType.Kind(), defaultValue, field.Name, err)
+		}
+
+		values = append(values, value.Interface().(T))
+	}
+
+	return values, nil
+}
+
+// parseSliceElements parses each of the given strings as a value of elemType using parse, and returns them as a slice.
+func (r *structReflector) parseSliceElements(elemType reflect.Type, values []string, parse func(string) (reflect.Value, error)) (reflect.Value, error) {
+	parsed := reflect.MakeSlice(reflect.SliceOf(elemType), 0, len(values))
+
+	// like for flags, whitespace around elements is only kept for plain strings
+	trim := elemType.Kind() != reflect.String || r.isParsedFromText(elemType)
+
+	for _, value := range values {
+		if trim {
+			value = strings.TrimSpace(value)
+		}
+
+		elem, err := parse(value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		parsed = reflect.Append(parsed, elem)
+	}
+
+	return parsed, nil
+}
+
+// parseScalar parses a string into a value of the given scalar type, or of a type implementing
+// encoding.TextUnmarshaler.
+func parseScalar(typ reflect.Type, value string) (reflect.Value, error) {
+	if isTextUnmarshaler(typ) {
+		return unmarshalText(typ, value)
+	}
+
+	parsed := reflect.New(typ).Elem()
+
+	switch typ.Kind() { //nolint:exhaustive  // we have a default: clause that results in an error
+	case reflect.String:
+		parsed.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if typ == durationType {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+
+			parsed.SetInt(int64(duration))
+			break
+		}
+
+		number, err := strconv.ParseInt(value, 10, typ.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		parsed.SetInt(number)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number, err := strconv.ParseUint(value, 10, typ.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		parsed.SetUint(number)
+	case reflect.Float32, reflect.Float64:
+		number, err := strconv.ParseFloat(value, typ.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		parsed.SetFloat(number)
+	case reflect.Bool:
+		boolean, err := strconv.ParseBool(value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		parsed.SetBool(boolean)
+	default:
+		return reflect.Value{}, fmt.Errorf("unknown field type %s", typ.Kind())
+	}
+
+	return parsed, nil
+}
+
+// setSliceValue sets the given slice as value of the slice field, converting the elements to the element type
+// of the field if necessary. Empty slices leave the field as nil slice.
+func setSliceValue(fieldValue reflect.Value, values reflect.Value) {
+	if !values.IsValid() || values.Len() == 0 {
+		fieldValue.SetZero()
+		return
+	}
+
+	elemType := fieldValue.Type().Elem()
+	converted := reflect.MakeSlice(fieldValue.Type(), values.Len(), values.Len())
+	for i := range values.Len() {
+		converted.Index(i).Set(values.Index(i).Convert(elemType))
+	}
+
+	fieldValue.Set(converted)
+}
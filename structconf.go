@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/urfave/cli/v3"
@@ -17,10 +19,57 @@ type options struct {
 	longDescription       string
 	enableShellCompletion bool
 	loadConfigFlagName    string
+	loadConfigEnvVar      string
+	loadConfigFlagUsage   string
+	envFileFlagName       string
+
+	dotEnvFiles         []string // dotenv files which are loaded if they exist
+	requiredDotEnvFiles []string // dotenv files which must exist, e.g. because they were passed by flag
+
+	secretFileEnvVarsOnly bool
+
+	configFiles       []string    // config files which must exist, e.g. because they were passed by flag
+	configSearchPaths []string    // config files which are loaded if they exist
+	loadedConfigFiles []*[]string // receive the paths of all loaded config files
+
+	configDirs []configDir
+
+	provenance          *ProvenanceReport
+	printConfigFlagName string
+
+	precedence []Source // order of precedence of sources, nil for the default order
+	envPrefix  string
+	tomlRoot   string
+
+	profile         string // profile used by default
+	profileFlagName string
+	profileEnvVar   string
+	selectedProfile string // profile selected by flag, which takes precedence over the env var
+
+	decoders map[reflect.Type]func(string) (any, error)
+	encoders map[reflect.Type]func(any) (string, error)
+
+	args []string // CLI args to parse, if known before the command is run
 }
 
 type Option func(opts *options)
 
+func newOptions(opts []Option) *options {
+	cfg := &options{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// withArgs makes the CLI args known at reflection time, so that elements of collections of structs can be
+// discovered from the flags they are configured by.
+func withArgs(args []string) Option {
+	return func(opts *options) {
+		opts.args = args
+	}
+}
+
 func WithVersion(version string) Option {
 	return func(opts *options) {
 		opts.version = version
@@ -49,12 +98,227 @@ func WithDefaultLoadConfigFlag() Option {
 	return WithLoadConfigFlag("load-config")
 }
 
+// WithLoadConfigFlag adds a flag with the given name for loading config files. The flag can be repeated, with earlier
+// files taking precedence over later ones. The format of each file is chosen by its extension, see NewConfigFileSource.
 func WithLoadConfigFlag(flagName string) Option {
 	return func(opts *options) {
 		opts.loadConfigFlagName = flagName
 	}
 }
 
+// WithDotEnvFiles loads env vars from the given dotenv files, which are skipped if they don't exist. Earlier files
+// take precedence over later ones, and env vars set in the environment of the process take precedence over all of
+// them. The environment of the process is not modified.
+func WithDotEnvFiles(files ...string) Option {
+	return func(opts *options) {
+		opts.dotEnvFiles = append(opts.dotEnvFiles, files...)
+	}
+}
+
+func WithDefaultEnvFileFlag() Option {
+	return WithEnvFileFlag("env-file")
+}
+
+// WithEnvFileFlag adds a flag with the given name for loading env vars from dotenv files, which take precedence over
+// the files specified using WithDotEnvFiles. See WithDotEnvFiles for details.
+func WithEnvFileFlag(flagName string) Option {
+	return func(opts *options) {
+		opts.envFileFlagName = flagName
+	}
+}
+
+// withRequiredDotEnvFiles loads env vars from the given dotenv files, which must exist.
+func withRequiredDotEnvFiles(files []string) Option {
+	return func(opts *options) {
+		opts.requiredDotEnvFiles = files
+	}
+}
+
+// WithConfigSearchPaths loads all config files that exist at the given paths, in order of precedence, e.g.
+//
+//	WithConfigSearchPaths("./app.toml", "$XDG_CONFIG_HOME/app/config.toml", "/etc/app/config.toml")
+//
+// loads a local config file, which takes precedence over a user config file, which in turn takes precedence over a
+// system wide config file. Env vars and a leading ~ in the paths are expanded. Config files loaded by flag take
+// precedence over the files found at search paths.
+func WithConfigSearchPaths(paths ...string) Option {
+	return func(opts *options) {
+		opts.configSearchPaths = append(opts.configSearchPaths, paths...)
+	}
+}
+
+// WithLoadedConfigFiles stores the paths of all config files that were loaded, either by flag or from search paths, in
+// the given slice, in order of precedence.
+func WithLoadedConfigFiles(files *[]string) Option {
+	return func(opts *options) {
+		opts.loadedConfigFiles = append(opts.loadedConfigFiles, files)
+	}
+}
+
+// WithLoadConfigEnvVar allows setting the flag added by WithLoadConfigFlag using the given env var, e.g.
+// APP_CONFIG=/etc/app/a.toml:/etc/app/b.toml, with files separated by the path list separator of the OS. Like for all
+// other flags, files passed by flag take precedence over the env var.
+func WithLoadConfigEnvVar(envVar string) Option {
+	return func(opts *options) {
+		opts.loadConfigEnvVar = envVar
+	}
+}
+
+// withLoadConfigFlagUsage sets the help text of the flag added by WithLoadConfigFlag.
+func withLoadConfigFlagUsage(usage string) Option {
+	return func(opts *options) {
+		opts.loadConfigFlagUsage = usage
+	}
+}
+
+// withConfigFiles loads the given config files, which must exist.
+func withConfigFiles(files []string) Option {
+	return func(opts *options) {
+		opts.configFiles = files
+	}
+}
+
+// WithConfigDir loads configuration from the files in the given directory, such as a Kubernetes ConfigMap or Secret
+// mounted as volume, with one file per field, named according to the given key format. The directory is skipped if it
+// doesn't exist. Config directories take precedence over env vars, but not over config files loaded by flag.
+func WithConfigDir(dir string, keyFormat DirectoryKeyFormat) Option {
+	return func(opts *options) {
+		opts.configDirs = append(opts.configDirs, configDir{dir: dir, keyFormat: keyFormat})
+	}
+}
+
+// WithProfile layers the overrides of the given profile over the values of each config file, e.g. the table
+// [profiles.staging] for the profile staging. Tables are merged recursively, all other values are replaced. Config files
+// not defining the profile are used as is.
+func WithProfile(profile string) Option {
+	return func(opts *options) {
+		opts.profile = profile
+	}
+}
+
+func WithDefaultProfileFlag() Option {
+	return WithProfileFlag("profile")
+}
+
+// WithProfileFlag adds a flag with the given name for selecting the profile of config files, which takes precedence
+// over the profile set by WithProfile. See WithProfile for details.
+//
+// The flag is only supported by LoadAndValidate and its variants, and BindCommand and NewCommand return an error if
+// this option is set. Use WithProfile or WithProfileEnvVar for bound commands instead.
+func WithProfileFlag(flagName string) Option {
+	return func(opts *options) {
+		opts.profileFlagName = flagName
+	}
+}
+
+// WithProfileEnvVar allows selecting the profile of config files using the given env var, e.g. APP_PROFILE=staging.
+// It takes precedence over the profile set by WithProfile, but not over the flag added by WithProfileFlag.
+func WithProfileEnvVar(envVar string) Option {
+	return func(opts *options) {
+		opts.profileEnvVar = envVar
+	}
+}
+
+// withSelectedProfile selects the profile passed by flag.
+func withSelectedProfile(profile string) Option {
+	return func(opts *options) {
+		opts.selectedProfile = profile
+	}
+}
+
+// WithProvenance stores the source of the value of every config field in the given report, e.g. which flag, env var
+// or config file it was loaded from, as well as all other sources defining a value for the field.
+func WithProvenance(report *ProvenanceReport) Option {
+	return func(opts *options) {
+		opts.provenance = report
+	}
+}
+
+func WithDefaultPrintConfigFlag() Option {
+	return WithPrintConfigFlag("print-config")
+}
+
+// WithPrintConfigFlag adds a flag with the given name, which prints the resolved config instead of running the
+// program, e.g. --print-config=toml. The flag selects the output format, which is one of toml, json, env or table.
+// The table format lists the source of each value as well, see WithProvenance. Values of secret fields are redacted.
+//
+// For LoadAndValidate, the config is printed in place of the help text, so MustLoadAndValidate prints it and exits
+// with a zero exit code. For BindCommand, the config is printed to the writer of the root command, and the action of
+// the command is not run.
+func WithPrintConfigFlag(flagName string) Option {
+	return func(opts *options) {
+		opts.printConfigFlagName = flagName
+	}
+}
+
+// WithPrecedence changes the order of precedence of sources, e.g.
+//
+//	WithPrecedence(SourceFlags, SourceEnv, SourceFiles, SourceDefaults)
+//
+// lets env vars take precedence over config files. Flags always take precedence over all other sources, and default
+// values are only used if no other source defines a value, so both may be omitted. Individual fields can override the
+// order using the precedence tag, e.g. `precedence:"env,file"`.
+func WithPrecedence(sources ...Source) Option {
+	return func(opts *options) {
+		opts.precedence = sources
+	}
+}
+
+// WithEnvPrefix prefixes the env vars of all fields with the given prefix, e.g. MYAPP_LOG_LEVEL instead of LOG_LEVEL
+// for the prefix MYAPP, to avoid collisions with env vars of other programs. This includes global fields, <KEY>_FILE
+// env vars, as well as the names of files in config directories keyed by DirectoryKeysEnv. Fields tagged with
+// `envprefix:"false"` are not prefixed, which for fields that aren't global includes all fields nested within a struct
+// tagged this way. Env vars set by options such as WithLoadConfigEnvVar are used as is.
+func WithEnvPrefix(prefix string) Option {
+	return func(opts *options) {
+		opts.envPrefix = strings.TrimSuffix(prefix, "_")
+	}
+}
+
+// WithTomlRoot reads the values of config files from the table at the given dotted key, e.g. [myapp] for the root
+// myapp, so that several programs can share a config file. This applies to YAML and JSON files as well. Profiles are
+// looked up within the table, e.g. [myapp.profiles.staging]. Config files not containing the table are ignored.
+func WithTomlRoot(root string) Option {
+	return func(opts *options) {
+		opts.tomlRoot = root
+	}
+}
+
+// WithSecretFileEnvVarsOnly restricts reading values from files referenced by <KEY>_FILE env vars, e.g.
+// DATABASE_PASSWORD_FILE=/run/secrets/db_pw, to fields tagged with `secret:"true"`. By default, this is supported for
+// all fields that can be set by an env var.
+func WithSecretFileEnvVarsOnly() Option {
+	return func(opts *options) {
+		opts.secretFileEnvVarsOnly = true
+	}
+}
+
+// WithDecoder registers a function to parse values of the given type from their string representation.
+//
+// Registered decoders take precedence over the built-in parsing rules, and are used for default values, env vars,
+// flags and config files alike. This allows using types which can't implement encoding.TextUnmarshaler, such as
+// *regexp.Regexp or types from third party packages.
+func WithDecoder(typ reflect.Type, decode func(value string) (any, error)) Option {
+	return func(opts *options) {
+		if opts.decoders == nil {
+			opts.decoders = make(map[reflect.Type]func(string) (any, error))
+		}
+		opts.decoders[typ] = decode
+	}
+}
+
+// WithEncoder registers a function to format values of the given type as string, when marshalling a config.
+//
+// It is the counterpart to WithDecoder, and takes precedence over the built-in formatting rules.
+func WithEncoder(typ reflect.Type, encode func(value any) (string, error)) Option {
+	return func(opts *options) {
+		if opts.encoders == nil {
+			opts.encoders = make(map[reflect.Type]func(any) (string, error))
+		}
+		opts.encoders[typ] = encode
+	}
+}
+
 // MustLoadAndValidate is like LoadAndValidate, but if it fails, it prints the error to stderr and exits
 // with a non-zero exit code.
 func MustLoadAndValidate(configPointer any, programName string, opts ...Option) {
@@ -82,9 +346,9 @@ func MustLoadAndValidateArgs(configPointer any, programName string, args []strin
 
 // LoadAndValidate loads the given config struct and validates it.
 //
-// It loads the config from the following sources in the given order:
+// It loads the config from the following sources in the given order, unless changed by WithPrecedence:
 // 1. command line flags
-// 2. config files (if the config struct satisfies the loadConfigFromTOMLFiles interface by embedding LoadTOMLConfig)
+// 2. config files (if the config struct embeds ConfigFiles, or the WithLoadConfigFlag option is used)
 // 3. environment variables
 // 4. default values defined in the field tags
 //
@@ -109,7 +373,9 @@ func LoadAndValidateArgs(configPointer any, programName string, args []string, o
 // When the command is executed, the config is loaded from flags, env vars and default values,
 // then validated before the optional action is executed.
 //
-// The WithLoadConfigFlag option is not currently supported for BindCommand/NewCommand.
+// Config files are loaded by the flag added by the WithLoadConfigFlag option or an embedded ConfigFiles field. If a
+// parent command defines a flag of the same name, config files passed to the parent are loaded as well, see
+// BindCommand.
 func NewCommand(configPointer any, commandName string, action cli.ActionFunc, opts ...Option) (*cli.Command, error) {
 	cmd := &cli.Command{
 		Name:   commandName,
@@ -129,24 +395,49 @@ func NewCommand(configPointer any, commandName string, action cli.ActionFunc, op
 // It appends reflected flags to the command and wraps the command's Action so that config
 // loading and validation are run before the existing Action.
 //
-// The WithLoadConfigFlag option is not currently supported for BindCommand/NewCommand.
+// Config files passed by the flag added by the WithLoadConfigFlag option or an embedded ConfigFiles field are loaded
+// once the flags of the command are parsed. If the flag isn't set on the command itself, the value of a flag with the
+// same name on the closest parent command is used instead, so that config files can be passed to a parent command and
+// are inherited by all its subcommands. Once the config files are known, the config struct is reflected again, so that
+// elements of slices and maps of structs defined in the files are discovered as well. Since the CLI args of the command
+// aren't known before they are parsed, such elements can't be discovered from flags, e.g. --upstream-0-url.
 func BindCommand(command *cli.Command, configPointer any, opts ...Option) error {
-	cfg := &options{}
-	for _, opt := range opts {
-		opt(cfg)
+	cfg := newOptions(opts)
+
+	if cfg.envFileFlagName != "" {
+		return errors.New("WithEnvFileFlag is not supported for BindCommand/NewCommand; use WithDotEnvFiles or LoadAndValidate for top-level commands")
 	}
 
+	if cfg.profileFlagName != "" {
+		return errors.New("WithProfileFlag is not supported for BindCommand/NewCommand; use WithProfile, WithProfileEnvVar or LoadAndValidate for top-level commands")
+	}
+
+	opts = append(slices.Clone(opts), configFilesOptions(configPointer)...)
+	cfg = newOptions(opts)
+
+	var (
+		mapSources []cli.MapSource
+		fileFlags  []cli.Flag
+		lazyFiles  *lazyConfigFileSource
+	)
+
 	if cfg.loadConfigFlagName != "" {
-		return errors.New("WithLoadConfigFlag is not supported for BindCommand/NewCommand; use LoadAndValidate for top-level commands")
+		// config files are only known once the flags of the command are parsed, so they are loaded lazily
+		lazyFiles = &lazyConfigFileSource{command: command, flagName: cfg.loadConfigFlagName}
+		mapSources = append(mapSources, lazyFiles)
+		fileFlags = append(fileFlags, newLoadConfigFlag(cfg))
+	}
+	if cfg.printConfigFlagName != "" {
+		fileFlags = append(fileFlags, newPrintConfigFlag(cfg))
 	}
 
-	config, err := NewStructConfigurator(configPointer, nil)
+	config, err := newStructReflector(configPointer, mapSources, opts...)
 	if err != nil {
 		return err
 	}
 
-	flags := append([]cli.Flag{}, command.Flags...)
-	flags = append(flags, config.Flags()...)
+	// the flag for loading config files comes first, so that it is set before other flags look up values in the files
+	flags := slices.Concat(fileFlags, command.Flags, config.Flags())
 
 	if duplicate := firstDuplicateFlagName(flags); duplicate != "" {
 		return fmt.Errorf("duplicate flag: --%s", duplicate)
@@ -168,7 +459,43 @@ func BindCommand(command *cli.Command, configPointer any, opts ...Option) error
 
 	wrappedAction := command.Action
 	command.Action = func(ctx context.Context, cmd *cli.Command) error {
-		config.Apply(cmd)
+		defer config.reset()
+
+		runOpts := opts
+		if lazyFiles != nil {
+			defer lazyFiles.reset()
+
+			// make sure the files are loaded, even if no value was looked up in them
+			_, files, err := lazyFiles.load()
+			if err != nil {
+				return err
+			}
+
+			runOpts = append(slices.Clone(opts), withConfigFiles(files))
+		}
+
+		loaded, loadedCmd, err := reflectForRun(configPointer, config, cmd, runOpts)
+		if err != nil {
+			return err
+		}
+
+		if err := loaded.lookupErr(); err != nil {
+			return err
+		}
+
+		loaded.Apply(loadedCmd)
+		if cfg.provenance != nil {
+			*cfg.provenance = loaded.provenance(loadedCmd)
+		}
+		if cfg.printConfigFlagName != "" && cmd.IsSet(cfg.printConfigFlagName) {
+			printed, err := loaded.printConfig(configPointer, loadedCmd, cmd.String(cfg.printConfigFlagName), cfg.encoders)
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprint(cmd.Root().Writer, printed)
+			return err
+		}
 		if err := validate(configPointer); err != nil {
 			return err
 		}
@@ -183,6 +510,54 @@ func BindCommand(command *cli.Command, configPointer any, opts ...Option) error
 	return nil
 }
 
+// reflectForRun reflects the given config struct again once the flags of a bound command are parsed, like the second
+// pass of LoadAndValidate, so that elements of collections of structs defined in the config files passed to the
+// command are discovered. Since flags keep their state across runs of a command, this also makes sure that values are
+// looked up in their sources on every run. It returns the new reflector, along with a command holding its flags: flags
+// set on the CLI of the bound command in the current run keep their values, all other flags are looked up in their
+// sources.
+func reflectForRun(configPointer any, bound *structReflector, cmd *cli.Command, opts []Option) (*structReflector, *cli.Command, error) {
+	config, err := newStructReflector(configPointer, nil, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	setOnCLI := make(map[string]*provenanceField, len(bound.provenanceFields))
+	for _, field := range bound.provenanceFields {
+		if field.setOnCLI() {
+			setOnCLI[field.flagName] = field
+		}
+	}
+
+	// all flags set on the CLI are taken over first, so that references to them are resolved to their values
+	flags := slices.Clone(config.Flags())
+	for _, field := range config.provenanceFields {
+		boundField, ok := setOnCLI[field.flagName]
+		if !ok {
+			continue
+		}
+
+		flags[slices.Index(flags, field.flag)] = boundField.flag
+		config.interpolator.replaceFlag(field.flag, boundField.flag)
+		field.flag, field.setCount = boundField.flag, boundField.setCount
+	}
+
+	for i, flag := range flags {
+		if flag != config.Flags()[i] { // set on the CLI
+			continue
+		}
+
+		if err := flag.PreParse(); err != nil {
+			return nil, nil, err
+		}
+		if err := flag.PostParse(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return config, &cli.Command{Name: cmd.Name, Flags: flags}, nil
+}
+
 type helpRequestedError struct {
 	helpText string
 }
@@ -192,27 +567,38 @@ func (e *helpRequestedError) Error() string {
 }
 
 func loadConfigWithArgs(configPointer any, programName string, args []string, opts ...Option) error {
-	cfg := &options{}
-	for _, opt := range opts {
-		opt(cfg)
-	}
-
-	tomlSources := make([]cli.MapSource, 0)
+	opts = append(slices.Clone(opts), configFilesOptions(configPointer)...)
+	opts = append(opts, withArgs(args))
+	cfg := newOptions(opts)
 
-	var loadConfigFlag cli.Flag
+	// flags for loading config files, which need to be parsed in a first pass before the config struct can be loaded
+	fileFlags := make([]cli.Flag, 0)
 	if cfg.loadConfigFlagName != "" {
-		loadConfigFlag = &cli.StringSliceFlag{
-			Name:  cfg.loadConfigFlagName,
-			Usage: "Load configuration from TOML files",
-		}
+		fileFlags = append(fileFlags, newLoadConfigFlag(cfg))
+	}
+	if cfg.envFileFlagName != "" {
+		fileFlags = append(fileFlags, &cli.StringSliceFlag{
+			Name:  cfg.envFileFlagName,
+			Usage: "Load environment variables from dotenv files",
+		})
+	}
+	if cfg.profileFlagName != "" {
+		fileFlags = append(fileFlags, newProfileFlag(cfg))
+	}
+
+	// flags which are only evaluated once the config is loaded, but must be known to the first pass as well
+	printFlags := make([]cli.Flag, 0)
+	if cfg.printConfigFlagName != "" {
+		printFlags = append(printFlags, newPrintConfigFlag(cfg))
+	}
 
-		config, err := NewStructConfigurator(configPointer, nil)
+	if len(fileFlags) > 0 {
+		config, err := NewStructConfigurator(configPointer, nil, opts...)
 		if err != nil {
 			return err
 		}
 
-		flags := config.Flags()
-		flags = append(flags, loadConfigFlag)
+		flags := slices.Concat(config.Flags(), fileFlags, printFlags)
 		if duplicate := firstDuplicateFlagName(flags); duplicate != "" {
 			return fmt.Errorf("got duplicate flag name: %s", duplicate)
 		}
@@ -230,13 +616,14 @@ func loadConfigWithArgs(configPointer any, programName string, args []string, op
 			EnableShellCompletion: cfg.enableShellCompletion,
 			Flags:                 flags,
 			Action: func(ctx context.Context, cmd *cli.Command) error {
-				tomlFiles := cmd.StringSlice(cfg.loadConfigFlagName)
-				for _, file := range tomlFiles {
-					source, err := NewTomlFileSource("toml", file)
-					if err != nil {
-						return err
-					}
-					tomlSources = append(tomlSources, source)
+				if cfg.loadConfigFlagName != "" {
+					opts = append(opts, withConfigFiles(cmd.StringSlice(cfg.loadConfigFlagName)))
+				}
+				if cfg.envFileFlagName != "" {
+					opts = append(opts, withRequiredDotEnvFiles(cmd.StringSlice(cfg.envFileFlagName)))
+				}
+				if cfg.profileFlagName != "" && cmd.IsSet(cfg.profileFlagName) {
+					opts = append(opts, withSelectedProfile(cmd.String(cfg.profileFlagName)))
 				}
 				return nil
 			},
@@ -257,15 +644,12 @@ func loadConfigWithArgs(configPointer any, programName string, args []string, op
 		}
 	}
 
-	config, err := NewStructConfigurator(configPointer, tomlSources)
+	config, err := newStructReflector(configPointer, nil, opts...)
 	if err != nil {
 		return err
 	}
 
-	flags := config.Flags()
-	if loadConfigFlag != nil {
-		flags = append(flags, loadConfigFlag)
-	}
+	flags := slices.Concat(config.Flags(), fileFlags, printFlags)
 
 	if duplicate := firstDuplicateFlagName(flags); duplicate != "" {
 		return fmt.Errorf("duplicate flag: --%s", duplicate)
@@ -285,7 +669,23 @@ func loadConfigWithArgs(configPointer any, programName string, args []string, op
 
 		Flags: flags,
 		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if err := config.lookupErr(); err != nil {
+				return err
+			}
+
 			config.Apply(cmd)
+			if cfg.provenance != nil {
+				*cfg.provenance = config.provenance(cmd)
+			}
+			if cfg.printConfigFlagName != "" && cmd.IsSet(cfg.printConfigFlagName) {
+				printed, err := config.printConfig(configPointer, cmd, cmd.String(cfg.printConfigFlagName), cfg.encoders)
+				if err != nil {
+					return err
+				}
+
+				// the config is printed instead of running the program, like the help text
+				return &helpRequestedError{helpText: strings.TrimSuffix(printed, "\n")}
+			}
 			return nil
 		},
 	}
@@ -307,6 +707,37 @@ func loadConfigWithArgs(configPointer any, programName string, args []string, op
 	return nil
 }
 
+// newLoadConfigFlag creates the flag for loading config files configured by WithLoadConfigFlag.
+func newLoadConfigFlag(cfg *options) *stringListFlag {
+	usage := cfg.loadConfigFlagUsage
+	if usage == "" {
+		usage = "Load configuration from TOML, YAML or JSON files"
+	}
+
+	flag := &stringListFlag{
+		Name:  cfg.loadConfigFlagName,
+		Usage: usage,
+	}
+	if cfg.loadConfigEnvVar != "" {
+		flag.Sources = cli.NewValueSourceChain(&pathListEnvSource{key: cfg.loadConfigEnvVar})
+	}
+
+	return flag
+}
+
+func newProfileFlag(cfg *options) *cli.StringFlag {
+	flag := &cli.StringFlag{
+		Name:  cfg.profileFlagName,
+		Usage: "Apply the overrides of the given profile in config files",
+		Value: cfg.profile,
+	}
+	if cfg.profileEnvVar != "" {
+		flag.Sources = cli.EnvVars(cfg.profileEnvVar)
+	}
+
+	return flag
+}
+
 func firstDuplicateFlagName(flags []cli.Flag) string {
 	seen := make(map[string]bool)
 
@@ -1,9 +1,17 @@
 package structconf
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/netip"
 	"os"
 	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"slices"
 	"strings"
 	"testing"
@@ -273,6 +281,2243 @@ second = "second_nested_config"
 	assert.Equal(t, "second_nested_config", cfg.Nested.Second)
 }
 
+func Test_loadConfigMergeStrategies(t *testing.T) {
+	type config struct {
+		Hosts    []string
+		Plugins  []string `merge:"append"`
+		Labels   map[string]string
+		Limits   map[string]int    `merge:"deep"`
+		Replaced map[string]string `merge:"replace"`
+	}
+
+	overrideConfig := strings.TrimSpace(`
+hosts = ["override"]
+plugins = ["metrics"]
+labels = { team = "override" }
+limits = { cpu = 4 }
+replaced = { a = "override" }
+`)
+	baseConfig := strings.TrimSpace(`
+hosts = ["base-1", "base-2"]
+plugins = ["auth", "logging"]
+labels = { team = "base", env = "prod" }
+limits = { cpu = 2, memory = 512 }
+replaced = { a = "base", b = "base" }
+`)
+
+	overrideConfigPath := path.Join(t.TempDir(), "override.toml")
+	require.NoError(t, os.WriteFile(overrideConfigPath, []byte(overrideConfig), 0o600))
+
+	baseConfigPath := path.Join(t.TempDir(), "base.toml")
+	require.NoError(t, os.WriteFile(baseConfigPath, []byte(baseConfig), 0o600))
+
+	cfg := &config{}
+	err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", overrideConfigPath, "--load-config", baseConfigPath}, WithDefaultLoadConfigFlag())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"override"}, cfg.Hosts)
+	assert.Equal(t, []string{"auth", "logging", "metrics"}, cfg.Plugins)
+	assert.Equal(t, map[string]string{"team": "override"}, cfg.Labels)
+	assert.Equal(t, map[string]int{"cpu": 4, "memory": 512}, cfg.Limits)
+	assert.Equal(t, map[string]string{"a": "override"}, cfg.Replaced)
+
+	t.Run("collections of structs", func(t *testing.T) {
+		type upstreamConfig struct {
+			Name string
+			URL  string
+		}
+
+		type structConfig struct {
+			Upstream  []upstreamConfig
+			Appended  []upstreamConfig `merge:"append"`
+			Databases map[string]upstreamConfig
+			Merged    map[string]upstreamConfig `merge:"deep"`
+		}
+
+		overridePath := path.Join(t.TempDir(), "override.toml")
+		require.NoError(t, os.WriteFile(overridePath, []byte(strings.TrimSpace(`
+[[upstream]]
+name = "a0"
+
+[[appended]]
+name = "a0"
+
+[databases.primary]
+name = "a-primary"
+
+[merged.primary]
+name = "a-primary"
+`)), 0o600))
+
+		basePath := path.Join(t.TempDir(), "base.toml")
+		require.NoError(t, os.WriteFile(basePath, []byte(strings.TrimSpace(`
+[[upstream]]
+name = "b0"
+url = "http://b0"
+
+[[upstream]]
+name = "b1"
+url = "http://b1"
+
+[[appended]]
+name = "b0"
+url = "http://b0"
+
+[databases.primary]
+name = "b-primary"
+url = "http://b-primary"
+
+[databases.replica]
+name = "b-replica"
+
+[merged.primary]
+name = "b-primary"
+url = "http://b-primary"
+
+[merged.replica]
+name = "b-replica"
+`)), 0o600))
+
+		cfg := &structConfig{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", overridePath, "--load-config", basePath}, WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+
+		assert.Equal(t, []upstreamConfig{{Name: "a0"}}, cfg.Upstream)
+		assert.Equal(t, []upstreamConfig{{Name: "b0", URL: "http://b0"}, {Name: "a0"}}, cfg.Appended)
+		assert.Equal(t, map[string]upstreamConfig{"primary": {Name: "a-primary"}}, cfg.Databases)
+		assert.Equal(t, map[string]upstreamConfig{
+			"primary": {Name: "a-primary", URL: "http://b-primary"},
+			"replica": {Name: "b-replica"},
+		}, cfg.Merged)
+	})
+
+	t.Run("unset by empty collections", func(t *testing.T) {
+		type upstreamConfig struct {
+			Name string
+		}
+
+		type unsetConfig struct {
+			Hosts    []string
+			Labels   map[string]string
+			Upstream []upstreamConfig
+		}
+
+		overridePath := path.Join(t.TempDir(), "override.toml")
+		require.NoError(t, os.WriteFile(overridePath, []byte(`hosts = []
+labels = {}
+upstream = []`), 0o600))
+
+		cfg := &unsetConfig{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", overridePath, "--load-config", baseConfigPath}, WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+
+		assert.Empty(t, cfg.Hosts)
+		assert.Empty(t, cfg.Labels)
+		assert.Empty(t, cfg.Upstream)
+	})
+
+	t.Run("invalid strategy", func(t *testing.T) {
+		type upstreamConfig struct {
+			Name string
+		}
+
+		tests := []struct {
+			name    string
+			config  any
+			wantErr string
+		}{
+			{"unknown for collection of structs", &struct {
+				Upstream []upstreamConfig `merge:"union"`
+			}{}, "invalid merge strategy \"union\" for field Upstream"},
+			{"append to map of structs", &struct {
+				Databases map[string]upstreamConfig `merge:"append"`
+			}{}, "only supported for slices"},
+			{"unknown", &struct {
+				Hosts []string `merge:"union"`
+			}{}, "invalid merge strategy \"union\" for field Hosts"},
+			{"append to map", &struct {
+				Labels map[string]string `merge:"append"`
+			}{}, "only supported for slices"},
+			{"deep merge slice", &struct {
+				Hosts []string `merge:"deep"`
+			}{}, "only supported for maps"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := loadConfigWithArgs(tt.config, "my-program", []string{"my-program"})
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			})
+		}
+	})
+}
+
+func Test_loadConfigProfiles(t *testing.T) {
+	type config struct {
+		LogLevel string
+		Database struct {
+			Host string
+			User string
+		}
+		Labels map[string]string
+	}
+
+	tomlConfig := strings.TrimSpace(`
+log-level = "info"
+labels = { team = "core" }
+
+[database]
+host = "localhost"
+user = "admin"
+
+[profiles.staging]
+log-level = "debug"
+database.host = "staging.example.com"
+
+[profiles.production.database]
+host = "production.example.com"
+`)
+	configPath := path.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(configPath, []byte(tomlConfig), 0o600))
+
+	tests := []struct {
+		name         string
+		args         []string
+		env          string
+		opts         []Option
+		wantLogLevel string
+		wantHost     string
+	}{
+		{"no profile", nil, "", nil, "info", "localhost"},
+		{"option", nil, "", []Option{WithProfile("staging")}, "debug", "staging.example.com"},
+		{"env var", nil, "production", []Option{WithProfile("staging")}, "info", "production.example.com"},
+		{"flag", []string{"--profile", "staging"}, "production", nil, "debug", "staging.example.com"},
+		{"undefined profile", nil, "", []Option{WithProfile("development")}, "info", "localhost"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("APP_PROFILE", tt.env)
+			}
+
+			opts := append([]Option{WithDefaultLoadConfigFlag(), WithDefaultProfileFlag(), WithProfileEnvVar("APP_PROFILE")}, tt.opts...)
+			args := append([]string{"my-program", "--load-config", configPath}, tt.args...)
+
+			cfg := &config{}
+			err := loadConfigWithArgs(cfg, "my-program", args, opts...)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantLogLevel, cfg.LogLevel)
+			assert.Equal(t, tt.wantHost, cfg.Database.Host)
+			assert.Equal(t, "admin", cfg.Database.User)
+			assert.Equal(t, map[string]string{"team": "core"}, cfg.Labels)
+		})
+	}
+
+	t.Run("BindCommand", func(t *testing.T) {
+		cfg := &config{}
+		cmd, err := NewCommand(cfg, "app", nil, WithDefaultLoadConfigFlag(), WithProfile("staging"))
+		require.NoError(t, err)
+
+		err = cmd.Run(context.Background(), []string{"app", "--load-config", configPath})
+		require.NoError(t, err)
+		assert.Equal(t, "debug", cfg.LogLevel)
+		assert.Equal(t, "staging.example.com", cfg.Database.Host)
+
+		_, err = NewCommand(&config{}, "app", nil, WithDefaultProfileFlag())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "WithProfileFlag is not supported")
+	})
+}
+
+func Test_loadConfigInterpolation(t *testing.T) {
+	type config struct {
+		DataDir string `default:"${APP_TEST_HOME}/.app"`
+		Server  struct {
+			Host string
+			Port int `default:"${APP_TEST_PORT}"`
+		}
+		URL      string
+		Region   string
+		Endpoint string
+		Literal  string
+	}
+
+	t.Setenv("APP_TEST_HOME", "/home/tilebox")
+	t.Setenv("APP_TEST_PORT", "8080")
+	t.Setenv("REGION", "eu-central-1")
+
+	tomlConfig := strings.TrimSpace(`
+url = "http://${server.host}:${server.port}"
+endpoint = "${url}/${region}"
+literal = "$${server.host}"
+
+[server]
+host = "localhost"
+`)
+	configPath := path.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(configPath, []byte(tomlConfig), 0o600))
+
+	cfg := &config{}
+	err := LoadAndValidateArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath}, WithDefaultLoadConfigFlag())
+	require.NoError(t, err)
+
+	assert.Equal(t, "/home/tilebox/.app", cfg.DataDir)
+	assert.Equal(t, 8080, cfg.Server.Port)
+	assert.Equal(t, "http://localhost:8080", cfg.URL)
+	assert.Equal(t, "http://localhost:8080/eu-central-1", cfg.Endpoint)
+	assert.Equal(t, "${server.host}", cfg.Literal)
+
+	t.Run("flags", func(t *testing.T) {
+		args := []string{"--load-config", configPath, "--server-port", "9", "--region", "us-west-1"}
+
+		cfg := &config{}
+		err := LoadAndValidateArgs(cfg, "my-program", append([]string{"my-program"}, args...), WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+
+		assert.Equal(t, "http://localhost:9", cfg.URL)
+		assert.Equal(t, "http://localhost:9/us-west-1", cfg.Endpoint)
+
+		cfg = &config{}
+		cmd, err := NewCommand(cfg, "app", nil, WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+		require.NoError(t, cmd.Run(context.Background(), append([]string{"app"}, args...)))
+
+		assert.Equal(t, "http://localhost:9", cfg.URL)
+		assert.Equal(t, "http://localhost:9/us-west-1", cfg.Endpoint)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			tomlConfig string
+			wantErr    string
+		}{
+			{"cycle", "url = \"${endpoint}\"\nendpoint = \"${url}\"", "reference cycle detected: "},
+			{"undefined", "url = \"${APP_TEST_UNDEFINED}\"", "undefined reference ${APP_TEST_UNDEFINED} in value of url"},
+			{"unterminated", "url = \"${server.host\"", "unterminated reference ${server.host in value of url"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				configPath := path.Join(t.TempDir(), "config.toml")
+				require.NoError(t, os.WriteFile(configPath, []byte(tt.tomlConfig), 0o600))
+
+				err := LoadAndValidateArgs(&config{}, "my-program", []string{"my-program", "--load-config", configPath}, WithDefaultLoadConfigFlag())
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+
+				cmd, err := NewCommand(&config{}, "app", nil, WithDefaultLoadConfigFlag())
+				require.NoError(t, err)
+				err = cmd.Run(context.Background(), []string{"app", "--load-config", configPath})
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			})
+		}
+	})
+}
+
+func Test_loadConfigProvenance(t *testing.T) {
+	type config struct {
+		Host     string `default:"localhost"`
+		Port     int    `default:"8080"`
+		LogLevel string `default:"info"`
+		Password string `secret:"true"`
+		Timeout  time.Duration
+		Tags     []string
+	}
+
+	overridePath := path.Join(t.TempDir(), "override.toml")
+	require.NoError(t, os.WriteFile(overridePath, []byte(`port = 9090`), 0o600))
+	basePath := path.Join(t.TempDir(), "base.toml")
+	require.NoError(t, os.WriteFile(basePath, []byte("port = 7070\nlog-level = \"debug\"\npassword = \"from-file\""), 0o600))
+
+	t.Setenv("PORT", "6060")
+	t.Setenv("PASSWORD", "super-secret")
+
+	report := &ProvenanceReport{}
+	err := loadConfigWithArgs(&config{}, "my-program", []string{"my-program", "--load-config", overridePath, "--load-config", basePath, "--log-level", "warn", "--tags", "a", "--tags", "b"}, WithDefaultLoadConfigFlag(), WithProvenance(report))
+	require.NoError(t, err)
+
+	host, ok := report.Field("host")
+	require.True(t, ok)
+	assert.Equal(t, &SourceValue{Source: SourceDefaults, Value: "localhost"}, host.Value)
+	assert.Empty(t, host.Shadowed)
+
+	port, ok := report.Field("port")
+	require.True(t, ok)
+	assert.Equal(t, "port", port.Flag)
+	assert.Equal(t, &SourceValue{Source: SourceFiles, Name: overridePath, Key: "port", Value: "9090"}, port.Value)
+	assert.Equal(t, []SourceValue{
+		{Source: SourceFiles, Name: basePath, Key: "port", Value: "7070"},
+		{Source: SourceEnv, Name: "PORT", Value: "6060"},
+		{Source: SourceDefaults, Value: "8080"},
+	}, port.Shadowed)
+
+	logLevel, ok := report.Field("log-level")
+	require.True(t, ok)
+	assert.Equal(t, &SourceValue{Source: SourceFlags, Name: "log-level", Value: "warn"}, logLevel.Value)
+	assert.Equal(t, []SourceValue{
+		{Source: SourceFiles, Name: basePath, Key: "log-level", Value: "debug"},
+		{Source: SourceDefaults, Value: "info"},
+	}, logLevel.Shadowed)
+
+	password, ok := report.Field("password")
+	require.True(t, ok)
+	assert.Equal(t, &SourceValue{Source: SourceFiles, Name: basePath, Key: "password", Value: "fr***le"}, password.Value)
+	assert.Equal(t, []SourceValue{{Source: SourceEnv, Name: "PASSWORD", Value: "su***et"}}, password.Shadowed)
+
+	timeout, ok := report.Field("timeout")
+	require.True(t, ok)
+	assert.Nil(t, timeout.Value)
+
+	tags, ok := report.Field("tags")
+	require.True(t, ok)
+	assert.Equal(t, &SourceValue{Source: SourceFlags, Name: "tags", Value: "a,b"}, tags.Value)
+
+	assert.Contains(t, report.String(), "port = 9090 (file "+overridePath+", key port)\n    shadowed: 7070 (file "+basePath+", key port)\n")
+	assert.Contains(t, report.String(), "log-level = warn (flag --log-level)\n")
+	assert.Contains(t, report.String(), "timeout: not set\n")
+
+	t.Run("merge strategies", func(t *testing.T) {
+		type mergedConfig struct {
+			Plugins []string       `merge:"append"`
+			Limits  map[string]int `merge:"deep"`
+			Hosts   []string
+		}
+
+		dir := t.TempDir()
+		aPath := path.Join(dir, "a.toml")
+		require.NoError(t, os.WriteFile(aPath, []byte("plugins = [\"a\"]\nlimits = { cpu = 4 }\nhosts = [\"a\"]"), 0o600))
+		bPath := path.Join(dir, "b.toml")
+		require.NoError(t, os.WriteFile(bPath, []byte("plugins = [\"b\"]\nlimits = { memory = 512 }\nhosts = [\"b\"]"), 0o600))
+
+		report := &ProvenanceReport{}
+		cfg := &mergedConfig{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", aPath, "--load-config", bPath, "--print-config", "table"}, WithDefaultLoadConfigFlag(), WithDefaultPrintConfigFlag(), WithProvenance(report))
+		helpRequested := &helpRequestedError{}
+		require.ErrorAs(t, err, &helpRequested)
+		assert.Equal(t, []string{"b", "a"}, cfg.Plugins)
+
+		plugins, ok := report.Field("plugins")
+		require.True(t, ok)
+		assert.Equal(t, &SourceValue{Source: SourceFiles, Value: "b,a", Merged: []SourceValue{
+			{Source: SourceFiles, Name: aPath, Key: "plugins", Value: "a"},
+			{Source: SourceFiles, Name: bPath, Key: "plugins", Value: "b"},
+		}}, plugins.Value)
+		assert.Empty(t, plugins.Shadowed)
+
+		limits, ok := report.Field("limits")
+		require.True(t, ok)
+		assert.Equal(t, "cpu=4,memory=512", limits.Value.Value)
+		assert.Len(t, limits.Value.Merged, 2)
+
+		hosts, ok := report.Field("hosts")
+		require.True(t, ok)
+		assert.Equal(t, &SourceValue{Source: SourceFiles, Name: aPath, Key: "hosts", Value: "a"}, hosts.Value)
+		assert.Equal(t, []SourceValue{{Source: SourceFiles, Name: bPath, Key: "hosts", Value: "b"}}, hosts.Shadowed)
+
+		assert.Contains(t, report.String(), "plugins = b,a (merged from files "+aPath+", "+bPath+")\n")
+		assert.Contains(t, helpRequested.helpText, "b,a               merged from files "+aPath+", "+bPath)
+	})
+
+	t.Run("BindCommand", func(t *testing.T) {
+		report := &ProvenanceReport{}
+		cmd, err := NewCommand(&config{}, "app", nil, WithProvenance(report))
+		require.NoError(t, err)
+
+		err = cmd.Run(context.Background(), []string{"app", "--host", "example.com"})
+		require.NoError(t, err)
+
+		host, ok := report.Field("host")
+		require.True(t, ok)
+		assert.Equal(t, &SourceValue{Source: SourceFlags, Name: "host", Value: "example.com"}, host.Value)
+
+		port, ok := report.Field("port")
+		require.True(t, ok)
+		assert.Equal(t, &SourceValue{Source: SourceEnv, Name: "PORT", Value: "6060"}, port.Value)
+	})
+
+	t.Run("interpolated values", func(t *testing.T) {
+		type interpolatedConfig struct {
+			DataDir string `default:"${APP_TEST_HOME}/.app"`
+			Host    string `default:"localhost"`
+			URL     string
+		}
+
+		t.Setenv("APP_TEST_HOME", "/home/tilebox")
+
+		configPath := path.Join(t.TempDir(), "config.toml")
+		require.NoError(t, os.WriteFile(configPath, []byte(`url = "http://${host}:8080"`), 0o600))
+
+		report := &ProvenanceReport{}
+		err := loadConfigWithArgs(&interpolatedConfig{}, "my-program", []string{"my-program", "--load-config", configPath, "--host", "example.com"}, WithDefaultLoadConfigFlag(), WithProvenance(report))
+		require.NoError(t, err)
+
+		dataDir, ok := report.Field("data-dir")
+		require.True(t, ok)
+		assert.Equal(t, &SourceValue{Source: SourceDefaults, Value: "/home/tilebox/.app"}, dataDir.Value)
+
+		url, ok := report.Field("url")
+		require.True(t, ok)
+		assert.Equal(t, &SourceValue{Source: SourceFiles, Name: configPath, Key: "url", Value: "http://example.com:8080"}, url.Value)
+	})
+}
+
+func Test_loadConfigPrintConfig(t *testing.T) {
+	type config struct {
+		Host     string `default:"localhost"`
+		Password string `secret:"true"`
+		Greeting string
+		Tags     []string
+		Server   struct {
+			Port    int `default:"8080"`
+			Enabled bool
+		}
+	}
+
+	t.Setenv("PASSWORD", "super-secret")
+	t.Setenv("GREETING", "hello world")
+
+	args := []string{"my-program", "--server-port", "9090", "--tags", "a", "--tags", "b"}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: "toml",
+			want: strings.TrimSpace(`
+greeting = "hello world"
+host = "localhost"
+password = "su***et"
+tags = ["a", "b"]
+
+[server]
+  enabled = false
+  port = 9090
+`),
+		},
+		{
+			format: "json",
+			want: strings.TrimSpace(`
+{
+  "greeting": "hello world",
+  "host": "localhost",
+  "password": "su***et",
+  "server": {
+    "enabled": false,
+    "port": 9090
+  },
+  "tags": [
+    "a",
+    "b"
+  ]
+}
+`),
+		},
+		{
+			format: "env",
+			want: strings.TrimSpace(`
+HOST=localhost
+PASSWORD=su***et
+GREETING='hello world'
+TAGS=a,b
+SERVER_PORT=9090
+SERVER_ENABLED=false
+`),
+		},
+		{
+			format: "table",
+			want: strings.TrimSpace(`
+FIELD           VALUE        SOURCE
+host            localhost    default
+password        su***et      env PASSWORD
+greeting        hello world  env GREETING
+tags            a,b          flag --tags
+server.port     9090         flag --server-port
+server.enabled  false        not set
+`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			err := loadConfigWithArgs(&config{}, "my-program", append(slices.Clone(args), "--print-config", tt.format), WithDefaultPrintConfigFlag())
+
+			helpRequested := &helpRequestedError{}
+			require.ErrorAs(t, err, &helpRequested)
+			assert.Equal(t, tt.want, helpRequested.helpText)
+		})
+	}
+
+	t.Run("env with commas in elements", func(t *testing.T) {
+		type listConfig struct {
+			Tags   []string
+			Labels map[string]string
+		}
+
+		configPath := path.Join(t.TempDir(), "config.toml")
+		require.NoError(t, os.WriteFile(configPath, []byte(strings.TrimSpace(`
+tags = ["a,b", 'C:\dir\', "c"]
+
+[labels]
+team = "core,platform"
+`)), 0o600))
+
+		err := loadConfigWithArgs(&listConfig{}, "my-program", []string{"my-program", "--load-config", configPath, "--print-config", "env"}, WithDefaultLoadConfigFlag(), WithDefaultPrintConfigFlag())
+		helpRequested := &helpRequestedError{}
+		require.ErrorAs(t, err, &helpRequested)
+		assert.Equal(t, `TAGS='a\,b,C:\dir\\,c'`+"\n"+`LABELS='team=core\,platform'`, helpRequested.helpText)
+
+		envPath := path.Join(t.TempDir(), ".env")
+		require.NoError(t, os.WriteFile(envPath, []byte(helpRequested.helpText), 0o600))
+
+		cfg := &listConfig{}
+		require.NoError(t, loadConfigWithArgs(cfg, "my-program", []string{"my-program"}, WithDotEnvFiles(envPath)))
+		assert.Equal(t, &listConfig{Tags: []string{"a,b", `C:\dir\`, "c"}, Labels: map[string]string{"team": "core,platform"}}, cfg)
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		err := loadConfigWithArgs(&config{}, "my-program", []string{"my-program", "--print-config", "xml"}, WithDefaultPrintConfigFlag())
+		require.ErrorContains(t, err, `invalid format "xml"`)
+	})
+
+	t.Run("BindCommand", func(t *testing.T) {
+		called := false
+		cmd, err := NewCommand(&config{}, "app", func(context.Context, *cli.Command) error {
+			called = true
+			return nil
+		}, WithDefaultPrintConfigFlag())
+		require.NoError(t, err)
+
+		printed := &bytes.Buffer{}
+		cmd.Writer = printed
+
+		err = cmd.Run(context.Background(), []string{"app", "--host", "example.com", "--print-config", "env"})
+		require.NoError(t, err)
+		assert.False(t, called)
+		assert.Contains(t, printed.String(), "HOST=example.com\n")
+	})
+}
+
+func Test_loadConfigSourcePrecedence(t *testing.T) {
+	type config struct {
+		Port     int
+		Host     string `precedence:"file,env"`
+		Endpoint string `default:"${host}:${port}"`
+	}
+
+	configPath := path.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(configPath, []byte("port = 9090\nhost = \"file.example.com\""), 0o600))
+
+	t.Setenv("PORT", "6060")
+	t.Setenv("HOST", "env.example.com")
+
+	t.Run("default", func(t *testing.T) {
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath}, WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+		assert.Equal(t, &config{Port: 9090, Host: "file.example.com", Endpoint: "file.example.com:9090"}, cfg)
+	})
+
+	t.Run("env before files", func(t *testing.T) {
+		cfg := &config{}
+		report := &ProvenanceReport{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath}, WithDefaultLoadConfigFlag(), WithProvenance(report),
+			WithPrecedence(SourceFlags, SourceEnv, SourceFiles, SourceDefaults))
+		require.NoError(t, err)
+		assert.Equal(t, &config{Port: 6060, Host: "file.example.com", Endpoint: "file.example.com:6060"}, cfg)
+
+		port, ok := report.Field("port")
+		require.True(t, ok)
+		assert.Equal(t, &SourceValue{Source: SourceEnv, Name: "PORT", Value: "6060"}, port.Value)
+		assert.Equal(t, []SourceValue{{Source: SourceFiles, Name: configPath, Key: "port", Value: "9090"}}, port.Shadowed)
+	})
+
+	t.Run("flags take precedence", func(t *testing.T) {
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath, "--port", "7070"}, WithDefaultLoadConfigFlag(),
+			WithPrecedence(SourceEnv, SourceFiles))
+		require.NoError(t, err)
+		assert.Equal(t, 7070, cfg.Port)
+	})
+
+	invalid := []struct {
+		name       string
+		precedence []Source
+		wantErr    string
+	}{
+		{name: "flags after env", precedence: []Source{SourceEnv, SourceFlags, SourceFiles}, wantErr: "flags must take precedence over all other sources"},
+		{name: "defaults before files", precedence: []Source{SourceEnv, SourceDefaults, SourceFiles}, wantErr: "default values must not take precedence"},
+		{name: "missing files", precedence: []Source{SourceEnv}, wantErr: `the order of "file" and "env" must be given`},
+		{name: "duplicate", precedence: []Source{SourceEnv, SourceEnv, SourceFiles}, wantErr: `duplicate source "env"`},
+		{name: "unknown", precedence: []Source{SourceEnv, "cli", SourceFiles}, wantErr: `unknown source "cli"`},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loadConfigWithArgs(&config{}, "my-program", []string{"my-program"}, WithPrecedence(tt.precedence...))
+			require.ErrorContains(t, err, "invalid precedence: "+tt.wantErr)
+		})
+	}
+
+	t.Run("invalid tag", func(t *testing.T) {
+		type invalidConfig struct {
+			Port int `precedence:"env"`
+		}
+
+		err := loadConfigWithArgs(&invalidConfig{}, "my-program", []string{"my-program"})
+		require.ErrorContains(t, err, `invalid precedence "env" for field Port`)
+	})
+}
+
+func Test_loadConfigEnvPrefix(t *testing.T) {
+	type upstreamConfig struct {
+		URL string
+	}
+
+	type config struct {
+		LogLevel string
+		Password string `secret:"true"`
+		Server   struct {
+			Port int
+			Host string `global:"true"`
+		}
+		Home string `envprefix:"false"`
+		Otel struct {
+			Endpoint string
+		} `envprefix:"false"`
+		Upstreams map[string]upstreamConfig
+	}
+
+	passwordPath := path.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordPath, []byte("my-password\n"), 0o600))
+
+	t.Setenv("LOG_LEVEL", "error")
+	t.Setenv("MYAPP_LOG_LEVEL", "debug")
+	t.Setenv("MYAPP_PASSWORD_FILE", passwordPath)
+	t.Setenv("MYAPP_SERVER_PORT", "8080")
+	t.Setenv("MYAPP_HOST", "example.com")
+	t.Setenv("HOME", "/home/me")
+	t.Setenv("OTEL_ENDPOINT", "collector:4317")
+	t.Setenv("MYAPP_UPSTREAMS_PRIMARY_URL", "http://primary")
+
+	cfg := &config{}
+	err := loadConfigWithArgs(cfg, "my-program", []string{"my-program"}, WithEnvPrefix("MYAPP"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, "my-password", cfg.Password)
+	assert.Equal(t, 8080, cfg.Server.Port)
+	assert.Equal(t, "example.com", cfg.Server.Host)
+	assert.Equal(t, "/home/me", cfg.Home)
+	assert.Equal(t, "collector:4317", cfg.Otel.Endpoint)
+	assert.Equal(t, map[string]upstreamConfig{"primary": {URL: "http://primary"}}, cfg.Upstreams)
+
+	t.Run("trailing underscore", func(t *testing.T) {
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program"}, WithEnvPrefix("MYAPP_"))
+		require.NoError(t, err)
+		assert.Equal(t, "debug", cfg.LogLevel)
+	})
+
+	t.Run("config directories keyed by env var", func(t *testing.T) {
+		type dirConfig struct {
+			Timeout string
+			Region  string `envprefix:"false"`
+		}
+
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(path.Join(dir, "TIMEOUT"), []byte("10s\n"), 0o600))
+		require.NoError(t, os.WriteFile(path.Join(dir, "MYAPP_TIMEOUT"), []byte("30s\n"), 0o600))
+		require.NoError(t, os.WriteFile(path.Join(dir, "REGION"), []byte("eu\n"), 0o600))
+
+		cfg := &dirConfig{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program"}, WithEnvPrefix("MYAPP"), WithConfigDir(dir, DirectoryKeysEnv))
+		require.NoError(t, err)
+		assert.Equal(t, "30s", cfg.Timeout)
+		assert.Equal(t, "eu", cfg.Region)
+	})
+}
+
+func Test_loadConfigTomlRoot(t *testing.T) {
+	type config struct {
+		LogLevel string
+		Server   struct {
+			Port int
+		}
+	}
+
+	configPath := path.Join(t.TempDir(), "shared.toml")
+	require.NoError(t, os.WriteFile(configPath, []byte(strings.TrimSpace(`
+log-level = "info"
+
+[tools.myapp]
+log-level = "debug"
+
+[tools.myapp.server]
+port = 8080
+
+[tools.myapp.profiles.staging]
+log-level = "warn"
+
+[tools.other]
+log-level = "error"
+`)), 0o600))
+
+	cfg := &config{}
+	err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath}, WithDefaultLoadConfigFlag(), WithTomlRoot("tools.myapp"))
+	require.NoError(t, err)
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, 8080, cfg.Server.Port)
+
+	t.Run("profile", func(t *testing.T) {
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath}, WithDefaultLoadConfigFlag(), WithTomlRoot("tools.myapp"), WithProfile("staging"))
+		require.NoError(t, err)
+		assert.Equal(t, "warn", cfg.LogLevel)
+	})
+
+	t.Run("missing root", func(t *testing.T) {
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath}, WithDefaultLoadConfigFlag(), WithTomlRoot("tools.missing"))
+		require.NoError(t, err)
+		assert.Equal(t, &config{}, cfg)
+	})
+
+	t.Run("print config", func(t *testing.T) {
+		err := loadConfigWithArgs(&config{}, "my-program", []string{"my-program", "--load-config", configPath, "--print-config", "toml"}, WithDefaultLoadConfigFlag(), WithTomlRoot("tools.myapp"), WithDefaultPrintConfigFlag())
+
+		helpRequested := &helpRequestedError{}
+		require.ErrorAs(t, err, &helpRequested)
+		assert.Contains(t, helpRequested.helpText, "[tools.myapp]\n")
+		assert.Contains(t, helpRequested.helpText, "log-level = \"debug\"")
+	})
+
+	t.Run("BindCommand", func(t *testing.T) {
+		cfg := &config{}
+		cmd, err := NewCommand(cfg, "app", nil, WithDefaultLoadConfigFlag(), WithTomlRoot("tools.myapp"))
+		require.NoError(t, err)
+
+		err = cmd.Run(context.Background(), []string{"app", "--load-config", configPath})
+		require.NoError(t, err)
+		assert.Equal(t, "debug", cfg.LogLevel)
+		assert.Equal(t, 8080, cfg.Server.Port)
+	})
+}
+
+func Test_loadConfigYamlFiles(t *testing.T) {
+	type upstreamConfig struct {
+		Name string
+		URL  string `yaml:"address"`
+	}
+
+	type config struct {
+		LogLevel string
+		Timeout  time.Duration
+		Tags     []string
+		Labels   map[string]string
+		Server   struct {
+			Port    int
+			Enabled bool
+		}
+		Upstream []upstreamConfig
+		TomlOnly string `yaml:"-"`
+	}
+
+	yamlConfig := strings.TrimSpace(`
+log-level: debug
+timeout: 5s
+tags: [a, b]
+labels:
+  team: core
+server:
+  port: 8080
+  enabled: true
+upstream:
+  - name: primary
+    address: https://primary.example.com
+toml-only: from-yaml
+`)
+	tomlConfig := strings.TrimSpace(`
+log-level = "info"
+toml-only = "from-toml"
+
+[server]
+port = 9090
+`)
+
+	yamlConfigPath := path.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(yamlConfigPath, []byte(yamlConfig), 0o600))
+
+	tomlConfigPath := path.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(tomlConfigPath, []byte(tomlConfig), 0o600))
+
+	cfg := &config{}
+	err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", yamlConfigPath, "--load-config", tomlConfigPath}, WithDefaultLoadConfigFlag())
+	require.NoError(t, err)
+
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, 5*time.Second, cfg.Timeout)
+	assert.Equal(t, []string{"a", "b"}, cfg.Tags)
+	assert.Equal(t, map[string]string{"team": "core"}, cfg.Labels)
+	assert.Equal(t, 8080, cfg.Server.Port)
+	assert.True(t, cfg.Server.Enabled)
+	assert.Equal(t, []upstreamConfig{{Name: "primary", URL: "https://primary.example.com"}}, cfg.Upstream)
+	assert.Equal(t, "from-toml", cfg.TomlOnly)
+
+	invalidPath := path.Join(t.TempDir(), "invalid.yaml")
+	require.NoError(t, os.WriteFile(invalidPath, []byte("log-level: [unterminated"), 0o600))
+
+	err = loadConfigWithArgs(&config{}, "my-program", []string{"my-program", "--load-config", invalidPath}, WithDefaultLoadConfigFlag())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse file as yaml")
+
+	t.Run("null values", func(t *testing.T) {
+		nullPath := path.Join(t.TempDir(), "null.yaml")
+		require.NoError(t, os.WriteFile(nullPath, []byte("log-level:\ntags:\nserver:\n  port: ~\n"), 0o600))
+
+		t.Setenv("SERVER_PORT", "7070")
+
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", nullPath}, WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+
+		assert.Empty(t, cfg.LogLevel)
+		assert.Nil(t, cfg.Tags)
+		assert.Equal(t, 7070, cfg.Server.Port)
+	})
+}
+
+func Test_loadConfigJSONFiles(t *testing.T) {
+	type config struct {
+		LogLevel  string
+		MaxSize   int64
+		Ratio     float64
+		Ports     []int
+		ServerURL string `json:"url"`
+		Database  struct {
+			User string
+		}
+		Labels map[string]string
+	}
+
+	jsonConfig := strings.TrimSpace(`
+{
+  "logLevel": "debug",
+  "maxSize": 10000000000,
+  "ratio": 0.25,
+  "ports": [80, 443],
+  "url": "https://example.com",
+  "database": {"user": "admin"},
+  "labels": {"team": "core"}
+}
+`)
+
+	configPath := path.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(jsonConfig), 0o600))
+
+	cfg := &config{}
+	err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath, "--log-level", "warn"}, WithDefaultLoadConfigFlag())
+	require.NoError(t, err)
+
+	assert.Equal(t, "warn", cfg.LogLevel)
+	assert.Equal(t, int64(10000000000), cfg.MaxSize)
+	assert.InDelta(t, 0.25, cfg.Ratio, 0.0001)
+	assert.Equal(t, []int{80, 443}, cfg.Ports)
+	assert.Equal(t, "https://example.com", cfg.ServerURL)
+	assert.Equal(t, "admin", cfg.Database.User)
+	assert.Equal(t, map[string]string{"team": "core"}, cfg.Labels)
+
+	invalidPath := path.Join(t.TempDir(), "invalid.json")
+	require.NoError(t, os.WriteFile(invalidPath, []byte(`{"logLevel": `), 0o600))
+
+	err = loadConfigWithArgs(&config{}, "my-program", []string{"my-program", "--load-config", invalidPath}, WithDefaultLoadConfigFlag())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse file as json")
+
+	t.Run("null values", func(t *testing.T) {
+		nullPath := path.Join(t.TempDir(), "null.json")
+		require.NoError(t, os.WriteFile(nullPath, []byte(`{"logLevel": null, "ports": null, "database": null, "labels": null}`), 0o600))
+
+		t.Setenv("DATABASE_USER", "root")
+
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", nullPath}, WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+
+		assert.Empty(t, cfg.LogLevel)
+		assert.Nil(t, cfg.Ports)
+		assert.Equal(t, "root", cfg.Database.User)
+		assert.Nil(t, cfg.Labels)
+	})
+}
+
+func Test_loadConfigTomlIncludes(t *testing.T) {
+	type config struct {
+		LogLevel string
+		Database struct {
+			Host string
+			User string
+		}
+		Queues map[string]string
+	}
+
+	writeFile := func(t *testing.T, file string, content string) {
+		t.Helper()
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0o700))
+		require.NoError(t, os.WriteFile(file, []byte(strings.TrimSpace(content)), 0o600))
+	}
+
+	t.Run("merge order", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, path.Join(dir, "app.toml"), `
+include = ["db.toml", "queues/*.toml"]
+log-level = "debug"
+
+[database]
+host = "db.example.com"
+`)
+		writeFile(t, path.Join(dir, "db.toml"), `
+log-level = "info"
+
+[database]
+host = "localhost"
+user = "admin"
+`)
+		writeFile(t, path.Join(dir, "queues", "a.toml"), `
+queues = { jobs = "jobs-a", events = "events-a" }
+`)
+		writeFile(t, path.Join(dir, "queues", "b.toml"), `
+[queues]
+jobs = "jobs-b"
+`)
+
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", path.Join(dir, "app.toml")}, WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+
+		assert.Equal(t, "debug", cfg.LogLevel)
+		assert.Equal(t, "db.example.com", cfg.Database.Host)
+		assert.Equal(t, "admin", cfg.Database.User)
+		assert.Equal(t, map[string]string{"jobs": "jobs-b", "events": "events-a"}, cfg.Queues)
+	})
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr []string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"app.toml":       `include = "nested/db.toml"`,
+				"nested/db.toml": `include = ["../app.toml"]`,
+			},
+			wantErr: []string{"include cycle detected", "app.toml -> ", "db.toml -> ", "app.toml"},
+		},
+		{
+			name: "missing file",
+			files: map[string]string{
+				"app.toml": `include = ["db.toml"]`,
+				"db.toml":  `include = ["missing.toml"]`,
+			},
+			wantErr: []string{"missing.toml", "file does not exist", "included by", "app.toml)"},
+		},
+		{
+			name: "invalid included file",
+			files: map[string]string{
+				"app.toml":      `include = ["db.toml"]`,
+				"db.toml":       `include = ["queues/*.toml"]`,
+				"queues/a.toml": `invalid`,
+			},
+			wantErr: []string{"failed to parse file as toml", "a.toml", "included by", "app.toml -> ", "db.toml"},
+		},
+		{
+			name: "invalid include value",
+			files: map[string]string{
+				"app.toml": `include = 1`,
+			},
+			wantErr: []string{"invalid include", "expected a string or an array of strings"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for file, content := range tt.files {
+				writeFile(t, path.Join(dir, file), content)
+			}
+
+			err := loadConfigWithArgs(&config{}, "my-program", []string{"my-program", "--load-config", path.Join(dir, "app.toml")}, WithDefaultLoadConfigFlag())
+			require.Error(t, err)
+			for _, wantErr := range tt.wantErr {
+				assert.Contains(t, err.Error(), wantErr)
+			}
+		})
+	}
+
+	t.Run("reserved include key", func(t *testing.T) {
+		type includeConfig struct {
+			Include string
+		}
+		err := loadConfigWithArgs(&includeConfig{}, "my-program", []string{"my-program"})
+		require.ErrorContains(t, err, `invalid toml key "include" for field Include, the top-level key "include" is reserved`)
+
+		type nestedConfig struct {
+			Include struct {
+				Path string
+			}
+		}
+		err = loadConfigWithArgs(&nestedConfig{}, "my-program", []string{"my-program"})
+		require.ErrorContains(t, err, `invalid toml key "include" for field Include`)
+
+		err = loadConfigWithArgs(&config{}, "my-program", []string{"my-program"}, WithTomlRoot("include.app"))
+		require.ErrorContains(t, err, `invalid toml root "include.app", the top-level key "include" is reserved`)
+
+		type renamedConfig struct {
+			Include string `toml:"include-path"`
+			Nested  struct {
+				Include string
+			}
+		}
+		dir := t.TempDir()
+		writeFile(t, path.Join(dir, "app.toml"), `
+include = "paths.toml"
+nested.include = "nested.txt"
+`)
+		writeFile(t, path.Join(dir, "paths.toml"), `include-path = "file.txt"`)
+
+		cfg := &renamedConfig{}
+		err = loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", path.Join(dir, "app.toml")}, WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+		assert.Equal(t, "file.txt", cfg.Include)
+		assert.Equal(t, "nested.txt", cfg.Nested.Include)
+	})
+
+	t.Run("include key within toml root", func(t *testing.T) {
+		type rootConfig struct {
+			Include string
+		}
+
+		dir := t.TempDir()
+		writeFile(t, path.Join(dir, "app.toml"), `
+include = "other.toml"
+
+[app]
+include = "file.txt"
+`)
+		writeFile(t, path.Join(dir, "other.toml"), `
+[app]
+include = "other.txt"
+`)
+
+		cfg := &rootConfig{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", path.Join(dir, "app.toml")}, WithDefaultLoadConfigFlag(), WithTomlRoot("app"))
+		require.NoError(t, err)
+		assert.Equal(t, "file.txt", cfg.Include)
+	})
+}
+
+func Test_parseDotEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "plain and exported values",
+			data: "# a comment\nFOO=bar\n\nexport  BAZ = qux \n",
+			want: map[string]string{"FOO": "bar", "BAZ": "qux"},
+		},
+		{
+			name: "quoted values and comments",
+			data: `SINGLE='no ${EXPANSION} # here'
+DOUBLE="line\nbreak \"quoted\" \$literal" # a comment
+UNQUOTED=value # a comment
+HASH=value#not-a-comment
+EMPTY=`,
+			want: map[string]string{
+				"SINGLE":   "no ${EXPANSION} # here",
+				"DOUBLE":   "line\nbreak \"quoted\" $literal",
+				"UNQUOTED": "value",
+				"HASH":     "value#not-a-comment",
+				"EMPTY":    "",
+			},
+		},
+		{
+			name: "variable expansion",
+			data: "HOST=localhost\nURL=http://${HOST}:$PORT/$UNDEFINED\nQUOTED=\"${HOST}\"",
+			want: map[string]string{"HOST": "localhost", "URL": "http://localhost:8080/", "QUOTED": "localhost"},
+		},
+		{
+			name:    "missing separator",
+			data:    "FOO=bar\nBAZ",
+			wantErr: "line 2: missing separator",
+		},
+		{
+			name:    "unterminated quote",
+			data:    `FOO="bar`,
+			wantErr: "line 1: unterminated quoted value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDotEnv(tt.data, func(key string) (string, bool) {
+				if key == "PORT" {
+					return "8080", true
+				}
+				return "", false
+			})
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_loadConfigDotEnvFiles(t *testing.T) {
+	type config struct {
+		Host     string
+		Port     int
+		Database struct {
+			User string
+		}
+	}
+
+	dir := t.TempDir()
+	defaultsPath := path.Join(dir, ".env")
+	require.NoError(t, os.WriteFile(defaultsPath, []byte("HOST=localhost\nPORT=8080\nDATABASE_USER=${USER_NAME}"), 0o600))
+	overridesPath := path.Join(dir, "overrides.env")
+	require.NoError(t, os.WriteFile(overridesPath, []byte("export PORT=9090"), 0o600))
+
+	t.Setenv("USER_NAME", "admin")
+	t.Setenv("HOST", "example.com") // env vars of the process take precedence over dotenv files
+
+	cfg := &config{}
+	err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--env-file", overridesPath}, WithDotEnvFiles(defaultsPath, path.Join(dir, "missing.env")), WithDefaultEnvFileFlag())
+	require.NoError(t, err)
+
+	assert.Equal(t, "example.com", cfg.Host)
+	assert.Equal(t, 9090, cfg.Port)
+	assert.Equal(t, "admin", cfg.Database.User)
+
+	_, isSet := os.LookupEnv("DATABASE_USER")
+	assert.False(t, isSet, "dotenv files must not modify the environment of the process")
+
+	err = loadConfigWithArgs(&config{}, "my-program", []string{"my-program", "--env-file", path.Join(dir, "missing.env")}, WithDefaultEnvFileFlag())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read file")
+}
+
+func Test_loadConfigFileEnvVars(t *testing.T) {
+	type config struct {
+		Database struct {
+			User     string
+			Password string `secret:"true"`
+		}
+	}
+
+	dir := t.TempDir()
+	passwordPath := path.Join(dir, "db_pw")
+	require.NoError(t, os.WriteFile(passwordPath, []byte("super-secret\n"), 0o600))
+	userPath := path.Join(dir, "db_user")
+	require.NoError(t, os.WriteFile(userPath, []byte("admin\n"), 0o600))
+
+	t.Setenv("DATABASE_PASSWORD_FILE", passwordPath)
+	t.Setenv("DATABASE_USER_FILE", userPath)
+
+	t.Run("all fields", func(t *testing.T) {
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program"})
+		require.NoError(t, err)
+		assert.Equal(t, "admin", cfg.Database.User)
+		assert.Equal(t, "super-secret", cfg.Database.Password)
+	})
+
+	t.Run("env var takes precedence", func(t *testing.T) {
+		t.Setenv("DATABASE_PASSWORD", "from-env")
+
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program"})
+		require.NoError(t, err)
+		assert.Equal(t, "from-env", cfg.Database.Password)
+	})
+
+	t.Run("secrets only", func(t *testing.T) {
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program"}, WithSecretFileEnvVarsOnly())
+		require.NoError(t, err)
+		assert.Empty(t, cfg.Database.User)
+		assert.Equal(t, "super-secret", cfg.Database.Password)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Setenv("DATABASE_PASSWORD_FILE", path.Join(dir, "missing"))
+
+		err := loadConfigWithArgs(&config{}, "my-program", []string{"my-program"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "referenced by env var DATABASE_PASSWORD_FILE")
+	})
+
+	t.Run("missing file ignored if env var is set", func(t *testing.T) {
+		t.Setenv("DATABASE_PASSWORD", "direct")
+		t.Setenv("DATABASE_PASSWORD_FILE", path.Join(dir, "missing"))
+
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program"})
+		require.NoError(t, err)
+		assert.Equal(t, "direct", cfg.Database.Password)
+	})
+
+	t.Run("env var of another field", func(t *testing.T) {
+		type logConfig struct {
+			Log     string `default:"info"`
+			LogFile string
+		}
+
+		t.Setenv("LOG_FILE", userPath)
+
+		cfg := &logConfig{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program"})
+		require.NoError(t, err)
+		assert.Equal(t, "info", cfg.Log)
+		assert.Equal(t, userPath, cfg.LogFile)
+
+		t.Setenv("LOG_FILE", path.Join(dir, "not-yet-created.log"))
+
+		cfg = &logConfig{}
+		err = loadConfigWithArgs(cfg, "my-program", []string{"my-program"})
+		require.NoError(t, err)
+		assert.Equal(t, "info", cfg.Log)
+	})
+}
+
+func Test_loadConfigDirectories(t *testing.T) {
+	type config struct {
+		LogLevel string
+		Port     int
+		Database struct {
+			User     string
+			Password string
+		}
+	}
+
+	writeFiles := func(t *testing.T, files map[string]string) string {
+		t.Helper()
+		dir := t.TempDir()
+		for name, content := range files {
+			require.NoError(t, os.WriteFile(path.Join(dir, name), []byte(content), 0o600))
+		}
+		return dir
+	}
+
+	envDir := writeFiles(t, map[string]string{"DATABASE_USER": "admin\n", "LOG_LEVEL": "debug"})
+	flagDir := writeFiles(t, map[string]string{"database-password": "super-secret\n", "port": "8080"})
+	tomlDir := writeFiles(t, map[string]string{"database.user": "ignored", "port": "9090"})
+
+	configPath := path.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`log-level = "info"`), 0o600))
+	t.Setenv("PORT", "1234") // config directories take precedence over env vars
+
+	cfg := &config{}
+	err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath},
+		WithDefaultLoadConfigFlag(),
+		WithConfigDir(envDir, DirectoryKeysEnv),
+		WithConfigDir(flagDir, DirectoryKeysFlag),
+		WithConfigDir(tomlDir, DirectoryKeysToml),
+		WithConfigDir(path.Join(envDir, "missing"), DirectoryKeysEnv),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "info", cfg.LogLevel)
+	assert.Equal(t, 8080, cfg.Port)
+	assert.Equal(t, "admin", cfg.Database.User)
+	assert.Equal(t, "super-secret", cfg.Database.Password)
+
+	_, err = NewDirectorySource(path.Join(envDir, "LOG_LEVEL"), DirectoryKeysEnv)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a directory")
+}
+
+func Test_loadConfigFilesFromEnvVar(t *testing.T) {
+	type config struct {
+		Value  string
+		Second string
+	}
+
+	dir := t.TempDir()
+	firstPath := path.Join(dir, "first.toml")
+	require.NoError(t, os.WriteFile(firstPath, []byte(`value = "first"`), 0o600))
+	secondPath := path.Join(dir, "second.toml")
+	require.NoError(t, os.WriteFile(secondPath, []byte("value = \"second\"\nsecond = \"second\""), 0o600))
+
+	t.Setenv("APP_CONFIG", firstPath+string(os.PathListSeparator)+secondPath)
+
+	cfg := &config{}
+	err := loadConfigWithArgs(cfg, "my-program", []string{"my-program"}, WithDefaultLoadConfigFlag(), WithLoadConfigEnvVar("APP_CONFIG"))
+	require.NoError(t, err)
+	assert.Equal(t, "first", cfg.Value)
+	assert.Equal(t, "second", cfg.Second)
+
+	// the flag takes precedence over the env var
+	cfg = &config{}
+	err = loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", secondPath}, WithDefaultLoadConfigFlag(), WithLoadConfigEnvVar("APP_CONFIG"))
+	require.NoError(t, err)
+	assert.Equal(t, "second", cfg.Value)
+
+	// paths containing commas are not split
+	commaPath := path.Join(dir, "with,comma.toml")
+	require.NoError(t, os.WriteFile(commaPath, []byte(`value = "comma"`), 0o600))
+	t.Setenv("APP_CONFIG", commaPath)
+
+	cfg = &config{}
+	err = loadConfigWithArgs(cfg, "my-program", []string{"my-program"}, WithDefaultLoadConfigFlag(), WithLoadConfigEnvVar("APP_CONFIG"))
+	require.NoError(t, err)
+	assert.Equal(t, "comma", cfg.Value)
+
+	err = loadConfigWithArgs(&config{}, "my-program", []string{"my-program", "--help"}, WithDefaultLoadConfigFlag(), WithLoadConfigEnvVar("APP_CONFIG"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "[$APP_CONFIG]")
+}
+
+func Test_loadConfigSearchPaths(t *testing.T) {
+	type config struct {
+		LogLevel string
+		Port     int
+		Host     string
+	}
+
+	systemDir := t.TempDir()
+	userDir := t.TempDir()
+	localDir := t.TempDir()
+
+	systemPath := path.Join(systemDir, "app", "config.toml")
+	require.NoError(t, os.MkdirAll(path.Dir(systemPath), 0o700))
+	require.NoError(t, os.WriteFile(systemPath, []byte("log-level = \"info\"\nport = 80\nhost = \"system\""), 0o600))
+
+	userPath := path.Join(userDir, "app", "config.yaml")
+	require.NoError(t, os.MkdirAll(path.Dir(userPath), 0o700))
+	require.NoError(t, os.WriteFile(userPath, []byte("port: 8080\nhost: user"), 0o600))
+
+	flagPath := path.Join(localDir, "flag.toml")
+	require.NoError(t, os.WriteFile(flagPath, []byte(`host = "flag"`), 0o600))
+
+	t.Setenv("XDG_CONFIG_HOME", userDir)
+
+	var loaded []string
+	cfg := &config{}
+	err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", flagPath},
+		WithDefaultLoadConfigFlag(),
+		WithConfigSearchPaths(path.Join(localDir, "app.toml"), "$XDG_CONFIG_HOME/app/config.yaml", systemPath),
+		WithLoadedConfigFiles(&loaded),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "info", cfg.LogLevel)
+	assert.Equal(t, 8080, cfg.Port)
+	assert.Equal(t, "flag", cfg.Host)
+	assert.Equal(t, []string{flagPath, userPath, systemPath}, loaded)
+}
+
+func Test_loadConfigSlices(t *testing.T) {
+	type config struct {
+		Origins   []string `default:"localhost,example.com"`
+		Ports     []int    `default:"80,443"`
+		Weights   []float64
+		Timeouts  []time.Duration `default:"1s"`
+		Protocols []string
+	}
+
+	type args struct {
+		cliArgs []string
+		envVars map[string]string
+		toml    string
+	}
+
+	tests := []struct {
+		name          string
+		args          *args
+		wantOrigins   []string
+		wantPorts     []int
+		wantWeights   []float64
+		wantTimeouts  []time.Duration
+		wantProtocols []string
+		wantErr       string
+	}{
+		{
+			name: "repeated flags",
+			args: &args{
+				cliArgs: []string{"my-program", "--origins", "a.com", "--origins", "b.com", "--ports", "8080,8081", "--timeouts", "2s", "--timeouts", "1m"},
+			},
+			wantOrigins:  []string{"a.com", "b.com"},
+			wantPorts:    []int{8080, 8081},
+			wantTimeouts: []time.Duration{2 * time.Second, time.Minute},
+		},
+		{
+			name: "comma separated env vars",
+			args: &args{
+				cliArgs: []string{"my-program"},
+				envVars: map[string]string{"ORIGINS": "a.com,b.com", "WEIGHTS": "0.5,1.5", "TIMEOUTS": "1h,5m"},
+			},
+			wantOrigins:  []string{"a.com", "b.com"},
+			wantPorts:    []int{80, 443},
+			wantWeights:  []float64{0.5, 1.5},
+			wantTimeouts: []time.Duration{time.Hour, 5 * time.Minute},
+		},
+		{
+			name: "escaped commas in env vars",
+			args: &args{
+				cliArgs: []string{"my-program"},
+				envVars: map[string]string{"ORIGINS": `a.com\,b.com,C:\dir\\,c.com`},
+			},
+			wantOrigins:  []string{"a.com,b.com", `C:\dir\`, "c.com"},
+			wantPorts:    []int{80, 443},
+			wantTimeouts: []time.Duration{time.Second},
+		},
+		{
+			name: "toml arrays",
+			args: &args{
+				cliArgs: []string{"my-program"},
+				toml: strings.TrimSpace(`
+origins = ["a.com", "b.com", "c.com"]
+ports = [1, 2]
+weights = [0.25]
+timeouts = ["10s"]
+`),
+			},
+			wantOrigins:  []string{"a.com", "b.com", "c.com"},
+			wantPorts:    []int{1, 2},
+			wantWeights:  []float64{0.25},
+			wantTimeouts: []time.Duration{10 * time.Second},
+		},
+		{
+			name: "toml array elements containing commas",
+			args: &args{
+				cliArgs: []string{"my-program"},
+				toml:    `origins = ["a.com,b.com", " c.com"]`,
+			},
+			wantOrigins:  []string{"a.com,b.com", " c.com"},
+			wantPorts:    []int{80, 443},
+			wantTimeouts: []time.Duration{time.Second},
+		},
+		{
+			name: "toml array elements containing commas for non-string elements",
+			args: &args{
+				cliArgs: []string{"my-program"},
+				toml:    `ports = ["1,2"]`,
+			},
+			wantErr: `parsing "1,2": invalid syntax`,
+		},
+		{
+			name: "default values",
+			args: &args{
+				cliArgs: []string{"my-program"},
+			},
+			wantOrigins:  []string{"localhost", "example.com"},
+			wantPorts:    []int{80, 443},
+			wantTimeouts: []time.Duration{time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config{}
+
+			configPath := path.Join(t.TempDir(), "test-config.toml")
+			require.NoError(t, os.WriteFile(configPath, []byte(tt.args.toml), 0o600))
+
+			cliArgs := slices.Clone(tt.args.cliArgs)
+			cliArgs = append(cliArgs, "--load-config", configPath)
+			SetArgsForTest(t, cliArgs)
+
+			for key, value := range tt.args.envVars {
+				t.Setenv(key, value)
+			}
+
+			err := loadConfigWithArgs(cfg, "my-program", os.Args, WithDefaultLoadConfigFlag())
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantOrigins, cfg.Origins)
+			assert.Equal(t, tt.wantPorts, cfg.Ports)
+			assert.Equal(t, tt.wantWeights, cfg.Weights)
+			assert.Equal(t, tt.wantTimeouts, cfg.Timeouts)
+			assert.Equal(t, tt.wantProtocols, cfg.Protocols)
+		})
+	}
+}
+
+func Test_loadConfigInvalidSliceDefault(t *testing.T) {
+	type config struct {
+		Ports []int `default:"80,not-a-number"`
+	}
+
+	err := loadConfigWithArgs(&config{}, "my-program", []string{"my-program"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse int value 80,not-a-number for field Ports")
+}
+
+func Test_loadConfigMaps(t *testing.T) {
+	type config struct {
+		Labels  map[string]string `default:"team=core"`
+		Weights map[string]float64
+	}
+
+	type args struct {
+		cliArgs []string
+		envVars map[string]string
+		toml    string
+	}
+
+	tests := []struct {
+		name        string
+		args        *args
+		wantLabels  map[string]string
+		wantWeights map[string]float64
+	}{
+		{
+			name: "repeated flags",
+			args: &args{
+				cliArgs: []string{"my-program", "--labels", "team=platform", "--labels", "env=prod", "--weights", "a=0.5,b=1.5"},
+			},
+			wantLabels:  map[string]string{"team": "platform", "env": "prod"},
+			wantWeights: map[string]float64{"a": 0.5, "b": 1.5},
+		},
+		{
+			name: "env vars",
+			args: &args{
+				cliArgs: []string{"my-program"},
+				envVars: map[string]string{"LABELS": "team=platform,env=dev", "WEIGHTS": "a=2"},
+			},
+			wantLabels:  map[string]string{"team": "platform", "env": "dev"},
+			wantWeights: map[string]float64{"a": 2},
+		},
+		{
+			name: "toml tables",
+			args: &args{
+				cliArgs: []string{"my-program"},
+				toml: strings.TrimSpace(`
+[labels]
+team = "data"
+
+[weights]
+a = 0.25
+b = 4
+`),
+			},
+			wantLabels:  map[string]string{"team": "data"},
+			wantWeights: map[string]float64{"a": 0.25, "b": 4},
+		},
+		{
+			name: "toml table values containing separators",
+			args: &args{
+				cliArgs: []string{"my-program"},
+				toml: strings.TrimSpace(`
+[labels]
+x = "1,2"
+query = "a=b,c=d"
+`),
+			},
+			wantLabels: map[string]string{"x": "1,2", "query": "a=b,c=d"},
+		},
+		{
+			name: "default values",
+			args: &args{
+				cliArgs: []string{"my-program"},
+			},
+			wantLabels: map[string]string{"team": "core"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config{}
+
+			configPath := path.Join(t.TempDir(), "test-config.toml")
+			require.NoError(t, os.WriteFile(configPath, []byte(tt.args.toml), 0o600))
+
+			cliArgs := slices.Clone(tt.args.cliArgs)
+			cliArgs = append(cliArgs, "--load-config", configPath)
+			SetArgsForTest(t, cliArgs)
+
+			for key, value := range tt.args.envVars {
+				t.Setenv(key, value)
+			}
+
+			err := loadConfigWithArgs(cfg, "my-program", os.Args, WithDefaultLoadConfigFlag())
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantLabels, cfg.Labels)
+			assert.Equal(t, tt.wantWeights, cfg.Weights)
+		})
+	}
+}
+
+func Test_loadConfigInvalidMapValue(t *testing.T) {
+	type config struct {
+		Weights map[string]float64
+	}
+
+	err := loadConfigWithArgs(&config{}, "my-program", []string{"my-program", "--weights", "a=heavy"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid value for key "a"`)
+}
+
+type testColor int
+
+const (
+	testColorRed testColor = iota + 1
+	testColorBlue
+)
+
+func (c testColor) MarshalText() ([]byte, error) {
+	switch c {
+	case testColorRed:
+		return []byte("red"), nil
+	case testColorBlue:
+		return []byte("blue"), nil
+	default:
+		return nil, fmt.Errorf("invalid color %d", int(c))
+	}
+}
+
+func (c *testColor) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "red":
+		*c = testColorRed
+	case "blue":
+		*c = testColorBlue
+	default:
+		return fmt.Errorf("unknown color %q", string(text))
+	}
+	return nil
+}
+
+func Test_loadConfigTextUnmarshaler(t *testing.T) {
+	type config struct {
+		Addr     netip.Addr
+		LogLevel slog.Level `default:"warn"`
+		Color    testColor  `default:"red"`
+		Peers    []netip.Addr
+	}
+
+	type args struct {
+		cliArgs []string
+		envVars map[string]string
+		toml    string
+	}
+
+	tests := []struct {
+		name         string
+		args         *args
+		wantAddr     netip.Addr
+		wantLogLevel slog.Level
+		wantColor    testColor
+		wantPeers    []netip.Addr
+	}{
+		{
+			name: "flags",
+			args: &args{
+				cliArgs: []string{"my-program", "--addr", "10.0.0.1", "--log-level", "debug", "--color", "blue", "--peers", "10.0.0.2,10.0.0.3"},
+			},
+			wantAddr:     netip.MustParseAddr("10.0.0.1"),
+			wantLogLevel: slog.LevelDebug,
+			wantColor:    testColorBlue,
+			wantPeers:    []netip.Addr{netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("10.0.0.3")},
+		},
+		{
+			name: "env vars and toml",
+			args: &args{
+				cliArgs: []string{"my-program"},
+				envVars: map[string]string{"ADDR": "::1", "LOG_LEVEL": "error"},
+				toml: strings.TrimSpace(`
+color = "blue"
+peers = ["10.0.0.4"]
+`),
+			},
+			wantAddr:     netip.MustParseAddr("::1"),
+			wantLogLevel: slog.LevelError,
+			wantColor:    testColorBlue,
+			wantPeers:    []netip.Addr{netip.MustParseAddr("10.0.0.4")},
+		},
+		{
+			name: "default values",
+			args: &args{
+				cliArgs: []string{"my-program"},
+			},
+			wantLogLevel: slog.LevelWarn,
+			wantColor:    testColorRed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config{}
+
+			configPath := path.Join(t.TempDir(), "test-config.toml")
+			require.NoError(t, os.WriteFile(configPath, []byte(tt.args.toml), 0o600))
+
+			cliArgs := slices.Clone(tt.args.cliArgs)
+			cliArgs = append(cliArgs, "--load-config", configPath)
+			SetArgsForTest(t, cliArgs)
+
+			for key, value := range tt.args.envVars {
+				t.Setenv(key, value)
+			}
+
+			err := loadConfigWithArgs(cfg, "my-program", os.Args, WithDefaultLoadConfigFlag())
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantAddr, cfg.Addr)
+			assert.Equal(t, tt.wantLogLevel, cfg.LogLevel)
+			assert.Equal(t, tt.wantColor, cfg.Color)
+			assert.Equal(t, tt.wantPeers, cfg.Peers)
+		})
+	}
+}
+
+func Test_loadConfigInvalidTextValue(t *testing.T) {
+	type config struct {
+		Color testColor
+	}
+
+	err := loadConfigWithArgs(&config{}, "my-program", []string{"my-program", "--color", "green"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown color "green"`)
+
+	type invalidDefault struct {
+		Color testColor `default:"green"`
+	}
+
+	err = loadConfigWithArgs(&invalidDefault{}, "my-program", []string{"my-program"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse structconf.testColor value green for field Color")
+}
+
+func Test_loadConfigDecoders(t *testing.T) {
+	type config struct {
+		Pattern  *regexp.Regexp `default:"^a+$"`
+		Excludes []*regexp.Regexp
+		Big      big.Int
+	}
+
+	decodeRegexp := WithDecoder(reflect.TypeFor[*regexp.Regexp](), func(value string) (any, error) {
+		return regexp.Compile(value)
+	})
+	decodeBigInt := WithDecoder(reflect.TypeFor[big.Int](), func(value string) (any, error) {
+		number, ok := new(big.Int).SetString(value, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid number %q", value)
+		}
+		return *number, nil
+	})
+
+	t.Run("default values and flags", func(t *testing.T) {
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--excludes", "^tmp", "--excludes", "bak$", "--big", "0xff"}, decodeRegexp, decodeBigInt)
+		require.NoError(t, err)
+
+		assert.Equal(t, "^a+$", cfg.Pattern.String())
+		require.Len(t, cfg.Excludes, 2)
+		assert.Equal(t, "^tmp", cfg.Excludes[0].String())
+		assert.Equal(t, "bak$", cfg.Excludes[1].String())
+		assert.Equal(t, "255", cfg.Big.String())
+	})
+
+	t.Run("env vars and toml", func(t *testing.T) {
+		configPath := path.Join(t.TempDir(), "test-config.toml")
+		require.NoError(t, os.WriteFile(configPath, []byte(`pattern = "^b+$"`), 0o600))
+		t.Setenv("BIG", "12345678901234567890")
+
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath}, WithDefaultLoadConfigFlag(), decodeRegexp, decodeBigInt)
+		require.NoError(t, err)
+
+		assert.Equal(t, "^b+$", cfg.Pattern.String())
+		assert.Empty(t, cfg.Excludes)
+		assert.Equal(t, "12345678901234567890", cfg.Big.String())
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		err := loadConfigWithArgs(&config{}, "my-program", []string{"my-program", "--pattern", "("}, decodeRegexp, decodeBigInt)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "missing closing )")
+	})
+
+	t.Run("incompatible decoder", func(t *testing.T) {
+		decodeAsString := WithDecoder(reflect.TypeFor[*regexp.Regexp](), func(value string) (any, error) {
+			return value, nil
+		})
+		err := loadConfigWithArgs(&config{}, "my-program", []string{"my-program"}, decodeAsString, decodeBigInt)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "decoder for *regexp.Regexp returned a value of incompatible type string")
+	})
+}
+
+func Test_loadConfigOptionalFields(t *testing.T) {
+	type config struct {
+		Timeout  *time.Duration
+		Retries  *int `default:"3"`
+		Name     *string
+		Enabled  *bool
+		Addr     *netip.Addr
+		Disabled *bool
+	}
+
+	t.Run("set to zero values", func(t *testing.T) {
+		configPath := path.Join(t.TempDir(), "test-config.toml")
+		require.NoError(t, os.WriteFile(configPath, []byte(`name = ""`), 0o600))
+		t.Setenv("ENABLED", "false")
+
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath, "--timeout", "0s", "--addr", "10.0.0.1"}, WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+
+		require.NotNil(t, cfg.Timeout)
+		assert.Equal(t, time.Duration(0), *cfg.Timeout)
+		require.NotNil(t, cfg.Retries)
+		assert.Equal(t, 3, *cfg.Retries)
+		require.NotNil(t, cfg.Name)
+		assert.Empty(t, *cfg.Name)
+		require.NotNil(t, cfg.Enabled)
+		assert.False(t, *cfg.Enabled)
+		require.NotNil(t, cfg.Addr)
+		assert.Equal(t, netip.MustParseAddr("10.0.0.1"), *cfg.Addr)
+		assert.Nil(t, cfg.Disabled)
+	})
+
+	t.Run("unset", func(t *testing.T) {
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program"})
+		require.NoError(t, err)
+
+		assert.Nil(t, cfg.Timeout)
+		assert.Nil(t, cfg.Name)
+		assert.Nil(t, cfg.Enabled)
+		assert.Nil(t, cfg.Addr)
+		require.NotNil(t, cfg.Retries)
+		assert.Equal(t, 3, *cfg.Retries)
+
+		asMap, err := MarshalAsMap(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"retries": int64(3)}, asMap)
+	})
+
+	t.Run("help text", func(t *testing.T) {
+		err := loadConfigWithArgs(&config{}, "my-program", []string{"my-program", "--unknown-value", "to_trigger_usage"})
+		require.Error(t, err)
+
+		assert.Contains(t, err.Error(), "--timeout duration   [$TIMEOUT]")
+		assert.Contains(t, err.Error(), "--retries int       (default: 3) [$RETRIES]")
+		assert.Contains(t, err.Error(), "--enabled            [$ENABLED]")
+		assert.NotContains(t, err.Error(), "(default: 0)")
+		assert.NotContains(t, err.Error(), "(default: false)")
+	})
+}
+
+func Test_loadConfigTime(t *testing.T) {
+	type config struct {
+		Cutoff   time.Time
+		Day      time.Time `default:"2025-01-01" layout:"2006-01-02"`
+		Timezone *time.Location
+		Optional *time.Time
+	}
+
+	t.Run("flags and default values", func(t *testing.T) {
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--cutoff", "2025-03-04T05:06:07+01:00", "--timezone", "Europe/Berlin"})
+		require.NoError(t, err)
+
+		assert.True(t, time.Date(2025, 3, 4, 4, 6, 7, 0, time.UTC).Equal(cfg.Cutoff))
+		assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), cfg.Day)
+		require.NotNil(t, cfg.Timezone)
+		assert.Equal(t, "Europe/Berlin", cfg.Timezone.String())
+		assert.Nil(t, cfg.Optional)
+	})
+
+	t.Run("env vars and native toml datetimes", func(t *testing.T) {
+		configPath := path.Join(t.TempDir(), "test-config.toml")
+		require.NoError(t, os.WriteFile(configPath, []byte(strings.TrimSpace(`
+cutoff = 2025-03-04T05:06:07Z
+day = 2025-02-03T00:00:00Z
+`)), 0o600))
+		t.Setenv("OPTIONAL", "2024-12-24T18:00:00Z")
+		t.Setenv("TIMEZONE", "UTC")
+
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath}, WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+
+		assert.Equal(t, time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC), cfg.Cutoff)
+		assert.Equal(t, time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC), cfg.Day)
+		assert.Equal(t, time.UTC, cfg.Timezone)
+		require.NotNil(t, cfg.Optional)
+		assert.Equal(t, time.Date(2024, 12, 24, 18, 0, 0, 0, time.UTC), *cfg.Optional)
+
+		asMap, err := MarshalAsMap(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{
+			"cutoff":   "2025-03-04T05:06:07Z",
+			"day":      "2025-02-03",
+			"timezone": "UTC",
+			"optional": "2024-12-24T18:00:00Z",
+		}, asMap)
+	})
+
+	t.Run("slices in layout", func(t *testing.T) {
+		type sliceConfig struct {
+			Holidays []time.Time `default:"2025-12-25,2025-12-26" layout:"2006-01-02"`
+		}
+
+		cfg := &sliceConfig{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program"})
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{time.Date(2025, 12, 25, 0, 0, 0, 0, time.UTC), time.Date(2025, 12, 26, 0, 0, 0, 0, time.UTC)}, cfg.Holidays)
+
+		configPath := path.Join(t.TempDir(), "test-config.toml")
+		require.NoError(t, os.WriteFile(configPath, []byte(`holidays = [2026-01-01T00:00:00Z, "2026-01-06"]`), 0o600))
+
+		cfg = &sliceConfig{}
+		err = loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath}, WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 6, 0, 0, 0, 0, time.UTC)}, cfg.Holidays)
+
+		asMap, err := MarshalAsMap(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"holidays": []any{"2026-01-01", "2026-01-06"}}, asMap)
+
+		err = loadConfigWithArgs(&sliceConfig{}, "my-program", []string{"my-program", "--holidays", "tomorrow"})
+		require.Error(t, err)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		err := loadConfigWithArgs(&config{}, "my-program", []string{"my-program", "--timezone", "Nowhere/Special"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown time zone Nowhere/Special")
+
+		err = loadConfigWithArgs(&config{}, "my-program", []string{"my-program", "--day", "yesterday"})
+		require.Error(t, err)
+	})
+}
+
+func Test_loadConfigStructSlices(t *testing.T) {
+	type upstreamConfig struct {
+		Name    string `validate:"required"`
+		URL     string `validate:"required,url"`
+		Retries int    `default:"3"`
+	}
+
+	type config struct {
+		Upstream []upstreamConfig
+		Backends []*upstreamConfig
+	}
+
+	t.Run("arrays of tables and indexed env vars", func(t *testing.T) {
+		configPath := path.Join(t.TempDir(), "test-config.toml")
+		require.NoError(t, os.WriteFile(configPath, []byte(strings.TrimSpace(`
+[[upstream]]
+name = "primary"
+url = "https://primary.example.com"
+
+[[upstream]]
+name = "secondary"
+url = "https://secondary.example.com"
+retries = 5
+`)), 0o600))
+		t.Setenv("UPSTREAM_1_RETRIES", "7") // the toml file takes precedence over env vars
+		t.Setenv("BACKENDS_0_NAME", "backend")
+		t.Setenv("BACKENDS_0_URL", "https://backend.example.com")
+
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath, "--upstream-0-retries", "1"}, WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+
+		assert.Equal(t, []upstreamConfig{
+			{Name: "primary", URL: "https://primary.example.com", Retries: 1},
+			{Name: "secondary", URL: "https://secondary.example.com", Retries: 5},
+		}, cfg.Upstream)
+		assert.Equal(t, []*upstreamConfig{
+			{Name: "backend", URL: "https://backend.example.com", Retries: 3},
+		}, cfg.Backends)
+
+		asMap, err := MarshalAsMap(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{
+			"upstream": []any{
+				map[string]any{"name": "primary", "url": "https://primary.example.com", "retries": int64(1)},
+				map[string]any{"name": "secondary", "url": "https://secondary.example.com", "retries": int64(5)},
+			},
+			"backends": []any{
+				map[string]any{"name": "backend", "url": "https://backend.example.com", "retries": int64(3)},
+			},
+		}, asMap)
+	})
+
+	t.Run("no elements", func(t *testing.T) {
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program"})
+		require.NoError(t, err)
+		assert.Nil(t, cfg.Upstream)
+		assert.Nil(t, cfg.Backends)
+	})
+
+	t.Run("unset by config file passed by flag", func(t *testing.T) {
+		dir := t.TempDir()
+		searchPath := path.Join(dir, "app.toml")
+		require.NoError(t, os.WriteFile(searchPath, []byte(strings.TrimSpace(`
+[[upstream]]
+name = "primary"
+
+[[upstream]]
+name = "secondary"
+`)), 0o600))
+		configPath := path.Join(dir, "override.toml")
+		require.NoError(t, os.WriteFile(configPath, []byte(`upstream = []`), 0o600))
+
+		cfg := &config{}
+		err := loadConfigWithArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath}, WithDefaultLoadConfigFlag(), WithConfigSearchPaths(searchPath))
+		require.NoError(t, err)
+		assert.Empty(t, cfg.Upstream)
+	})
+
+	t.Run("bound commands don't discover elements from flags", func(t *testing.T) {
+		t.Setenv("UPSTREAM_0_NAME", "primary")
+		t.Setenv("UPSTREAM_0_URL", "https://primary.example.com")
+
+		cfg := &config{}
+		cmd, err := NewCommand(cfg, "app", nil)
+		require.NoError(t, err)
+
+		err = cmd.Run(context.Background(), []string{"app", "--upstream-0-retries", "1"})
+		require.NoError(t, err)
+		assert.Equal(t, []upstreamConfig{{Name: "primary", URL: "https://primary.example.com", Retries: 1}}, cfg.Upstream)
+
+		cmd, err = NewCommand(&config{}, "app", nil)
+		require.NoError(t, err)
+
+		err = cmd.Run(context.Background(), []string{"app", "--upstream-1-name", "secondary"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "flag provided but not defined: -upstream-1-name")
+	})
+
+	t.Run("each element is validated", func(t *testing.T) {
+		t.Setenv("UPSTREAM_0_NAME", "primary")
+		t.Setenv("UPSTREAM_0_URL", "not a url")
+		t.Setenv("UPSTREAM_1_URL", "https://secondary.example.com")
+
+		err := LoadAndValidateArgs(&config{}, "my-program", []string{"my-program"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Configuration error: Upstream[0].URL - url")
+		assert.Contains(t, err.Error(), "Missing required configuration: config.Upstream[1].Name")
+	})
+}
+
+func Test_loadConfigStructMaps(t *testing.T) {
+	type databaseConfig struct {
+		Host     string `validate:"required"`
+		Port     int    `default:"5432"`
+		Password string `secret:"true"`
+	}
+
+	type config struct {
+		Databases map[string]databaseConfig
+		Caches    map[string]*databaseConfig
+	}
+
+	t.Run("tables and env vars", func(t *testing.T) {
+		configPath := path.Join(t.TempDir(), "test-config.toml")
+		require.NoError(t, os.WriteFile(configPath, []byte(strings.TrimSpace(`
+[databases.primary]
+host = "db1.example.com"
+
+[databases.replica]
+host = "db2.example.com"
+port = 5433
+`)), 0o600))
+		t.Setenv("DATABASES_READ_ONLY_HOST", "db3.example.com")
+		t.Setenv("DATABASES_PRIMARY_PASSWORD", "super-secret")
+		t.Setenv("CACHES_REDIS_HOST", "redis.example.com")
+		t.Setenv("CACHES_REDIS_PORT", "6379")
+
+		cfg := &config{}
+		err := LoadAndValidateArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath, "--databases-replica-port", "6432"}, WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]databaseConfig{
+			"primary":   {Host: "db1.example.com", Port: 5432, Password: "super-secret"},
+			"replica":   {Host: "db2.example.com", Port: 6432},
+			"read_only": {Host: "db3.example.com", Port: 5432},
+		}, cfg.Databases)
+		assert.Equal(t, map[string]*databaseConfig{
+			"redis": {Host: "redis.example.com", Port: 6379},
+		}, cfg.Caches)
+
+		asMap, err := MarshalAsMap(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{
+			"databases": map[string]any{
+				"primary":   map[string]any{"host": "db1.example.com", "port": int64(5432), "password": "su***et"},
+				"replica":   map[string]any{"host": "db2.example.com", "port": int64(6432)},
+				"read_only": map[string]any{"host": "db3.example.com", "port": int64(5432)},
+			},
+			"caches": map[string]any{
+				"redis": map[string]any{"host": "redis.example.com", "port": int64(6379)},
+			},
+		}, asMap)
+	})
+
+	t.Run("instances discovered from flags", func(t *testing.T) {
+		cfg := &config{}
+		err := LoadAndValidateArgs(cfg, "my-program", []string{"my-program", "--databases-primary-host", "db1.example.com", "--caches-redis-port=6379", "--caches-redis-host", "redis.example.com"})
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]databaseConfig{
+			"primary": {Host: "db1.example.com", Port: 5432},
+		}, cfg.Databases)
+		assert.Equal(t, map[string]*databaseConfig{
+			"redis": {Host: "redis.example.com", Port: 6379},
+		}, cfg.Caches)
+	})
+
+	t.Run("unset by config file passed by flag", func(t *testing.T) {
+		dir := t.TempDir()
+		searchPath := path.Join(dir, "app.toml")
+		require.NoError(t, os.WriteFile(searchPath, []byte(strings.TrimSpace(`
+[databases.primary]
+host = "db1.example.com"
+`)), 0o600))
+		configPath := path.Join(dir, "override.toml")
+		require.NoError(t, os.WriteFile(configPath, []byte(`databases = {}`), 0o600))
+
+		cfg := &config{}
+		err := LoadAndValidateArgs(cfg, "my-program", []string{"my-program", "--load-config", configPath}, WithDefaultLoadConfigFlag(), WithConfigSearchPaths(searchPath))
+		require.NoError(t, err)
+		assert.Nil(t, cfg.Databases)
+	})
+
+	t.Run("validation errors include the instance key", func(t *testing.T) {
+		t.Setenv("DATABASES_PRIMARY_PORT", "1234")
+
+		err := LoadAndValidateArgs(&config{}, "my-program", []string{"my-program"})
+		require.Error(t, err)
+		assert.Equal(t, "Missing required configuration: config.Databases[primary].Host\n", err.Error())
+	})
+}
+
 func Test_loadConfigExtraFlags(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -435,15 +2680,225 @@ func Test_NewCommandSubcommands(t *testing.T) {
 	assert.Equal(t, 0, sumCfg.Right)
 }
 
-func Test_BindCommandRejectsLoadConfigFlag(t *testing.T) {
+func Test_BindCommandLoadConfigFlag(t *testing.T) {
 	type config struct {
-		Name string
+		Name     string `validate:"required"`
+		Greeting string `default:"Hello"`
 	}
 
-	cmd := &cli.Command{Name: "greet"}
-	err := BindCommand(cmd, &config{}, WithDefaultLoadConfigFlag())
-	require.Error(t, err)
-	assert.Contains(t, err.Error(), "WithLoadConfigFlag is not supported")
+	dir := t.TempDir()
+	parentPath := path.Join(dir, "parent.toml")
+	require.NoError(t, os.WriteFile(parentPath, []byte(`name = "parent"`), 0o600))
+	childPath := path.Join(dir, "child.toml")
+	require.NoError(t, os.WriteFile(childPath, []byte("name = \"child\"\ngreeting = \"Hi\""), 0o600))
+
+	tests := []struct {
+		name         string
+		args         []string
+		wantName     string
+		wantGreeting string
+	}{
+		{"subcommand flag", []string{"app", "greet", "--config", childPath}, "child", "Hi"},
+		{"inherited from parent", []string{"app", "--config", parentPath, "greet"}, "parent", "Hello"},
+		{"subcommand flag overrides parent", []string{"app", "--config", parentPath, "greet", "--config", childPath}, "child", "Hi"},
+		{"flags override config files", []string{"app", "--config", parentPath, "greet", "--name", "flag"}, "flag", "Hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config{}
+			var loaded []string
+			greetCmd, err := NewCommand(cfg, "greet", nil, WithLoadConfigFlag("config"), WithLoadedConfigFiles(&loaded))
+			require.NoError(t, err)
+
+			root := &cli.Command{
+				Name:     "app",
+				Flags:    []cli.Flag{&cli.StringSliceFlag{Name: "config"}},
+				Commands: []*cli.Command{greetCmd},
+			}
+			err = root.Run(context.Background(), tt.args)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantName, cfg.Name)
+			assert.Equal(t, tt.wantGreeting, cfg.Greeting)
+			assert.Len(t, loaded, 1)
+		})
+	}
+
+	t.Run("run twice", func(t *testing.T) {
+		cfg := &config{}
+		report := &ProvenanceReport{}
+		greetCmd, err := NewCommand(cfg, "greet", nil, WithLoadConfigFlag("config"), WithProvenance(report))
+		require.NoError(t, err)
+
+		root := &cli.Command{Name: "app", Commands: []*cli.Command{greetCmd}}
+		err = root.Run(context.Background(), []string{"app", "greet", "--config", parentPath})
+		require.NoError(t, err)
+		assert.Equal(t, "parent", cfg.Name)
+		assert.Equal(t, "Hello", cfg.Greeting)
+
+		err = root.Run(context.Background(), []string{"app", "greet", "--config", childPath})
+		require.NoError(t, err)
+		assert.Equal(t, "child", cfg.Name)
+		assert.Equal(t, "Hi", cfg.Greeting)
+
+		greeting, ok := report.Field("greeting")
+		require.True(t, ok)
+		assert.Equal(t, &SourceValue{Source: SourceFiles, Name: childPath, Key: "greeting", Value: "Hi"}, greeting.Value)
+
+		err = root.Run(context.Background(), []string{"app", "greet", "--config", parentPath, "--greeting", "Hey"})
+		require.NoError(t, err)
+		assert.Equal(t, "parent", cfg.Name)
+		assert.Equal(t, "Hey", cfg.Greeting)
+
+		err = root.Run(context.Background(), []string{"app", "greet", "--config", childPath})
+		require.NoError(t, err)
+		assert.Equal(t, "Hi", cfg.Greeting)
+
+		greeting, ok = report.Field("greeting")
+		require.True(t, ok)
+		assert.Equal(t, SourceFiles, greeting.Value.Source)
+
+		t.Setenv("NAME", "env")
+		t.Setenv("GREETING", "Howdy")
+		for range 2 {
+			err = root.Run(context.Background(), []string{"app", "greet"})
+			require.NoError(t, err)
+			assert.Equal(t, "env", cfg.Name)
+			assert.Equal(t, "Howdy", cfg.Greeting)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		greetCmd, err := NewCommand(&config{}, "greet", nil, WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+
+		root := &cli.Command{Name: "app", Commands: []*cli.Command{greetCmd}}
+		err = root.Run(context.Background(), []string{"app", "greet", "--load-config", path.Join(dir, "missing.toml")})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "missing.toml")
+	})
+
+	t.Run("collections of structs", func(t *testing.T) {
+		type upstream struct {
+			URL     string `validate:"required"`
+			Retries int    `default:"3"`
+		}
+		type database struct {
+			Host string
+		}
+		type collectionsConfig struct {
+			Name string
+			Ups  []upstream
+			Dbs  map[string]database
+		}
+
+		collectionsPath := path.Join(dir, "collections.toml")
+		require.NoError(t, os.WriteFile(collectionsPath, []byte(strings.TrimSpace(`
+name = "file"
+
+[[ups]]
+url = "https://a.example.com"
+
+[[ups]]
+url = "https://b.example.com"
+retries = 5
+
+[dbs.primary]
+host = "db.example.com"
+`)), 0o600))
+
+		// the first element is known before parsing the flags, so it can be set by flag as well
+		t.Setenv("UPS_0_URL", "https://env.example.com")
+
+		cfg := &collectionsConfig{}
+		greetCmd, err := NewCommand(cfg, "greet", nil, WithDefaultLoadConfigFlag())
+		require.NoError(t, err)
+
+		root := &cli.Command{Name: "app", Commands: []*cli.Command{greetCmd}}
+		err = root.Run(context.Background(), []string{"app", "greet", "--load-config", collectionsPath, "--name", "flag", "--ups-0-url", "https://flag.example.com"})
+		require.NoError(t, err)
+
+		assert.Equal(t, "flag", cfg.Name)
+		assert.Equal(t, []upstream{{URL: "https://flag.example.com", Retries: 3}, {URL: "https://b.example.com", Retries: 5}}, cfg.Ups)
+		assert.Equal(t, map[string]database{"primary": {Host: "db.example.com"}}, cfg.Dbs)
+	})
+}
+
+func Test_loadConfigEmbeddedConfigFiles(t *testing.T) {
+	type config struct {
+		ConfigFiles `flag:"config" env:"APP_CONFIG" help:"Config files to load"`
+		Name        string `validate:"required"`
+		Greeting    string `default:"Hello"`
+	}
+
+	dir := t.TempDir()
+	firstPath := path.Join(dir, "first.toml")
+	require.NoError(t, os.WriteFile(firstPath, []byte(`name = "tilebox"`), 0o600))
+	secondPath := path.Join(dir, "second.yaml")
+	require.NoError(t, os.WriteFile(secondPath, []byte("name: ignored\ngreeting: Hi"), 0o600))
+
+	t.Run("LoadAndValidate", func(t *testing.T) {
+		cfg := &config{}
+		err := LoadAndValidateArgs(cfg, "my-program", []string{"my-program", "--config", firstPath, "--config", secondPath})
+		require.NoError(t, err)
+
+		assert.Equal(t, "tilebox", cfg.Name)
+		assert.Equal(t, "Hi", cfg.Greeting)
+		assert.Equal(t, []string{firstPath, secondPath}, cfg.LoadedConfigFiles)
+
+		asMap, err := MarshalAsMap(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"name": "tilebox", "greeting": "Hi"}, asMap)
+
+		err = LoadAndValidateArgs(&config{}, "my-program", []string{"my-program", "--help"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Config files to load")
+		assert.Contains(t, err.Error(), "[$APP_CONFIG]")
+	})
+
+	t.Run("BindCommand", func(t *testing.T) {
+		t.Setenv("APP_CONFIG", secondPath)
+
+		run := func(t *testing.T, args ...string) *config {
+			t.Helper()
+
+			cfg := &config{}
+			greetRan := false
+			greetCmd, err := NewCommand(cfg, "greet", func(ctx context.Context, cmd *cli.Command) error {
+				greetRan = true
+				return nil
+			})
+			require.NoError(t, err)
+
+			root := &cli.Command{Name: "app", Commands: []*cli.Command{greetCmd}}
+			err = root.Run(context.Background(), append([]string{"app", "greet"}, args...))
+			require.NoError(t, err)
+			assert.True(t, greetRan)
+
+			return cfg
+		}
+
+		cfg := run(t, "--config", firstPath)
+		assert.Equal(t, "tilebox", cfg.Name)
+		assert.Equal(t, "Hello", cfg.Greeting)
+		assert.Equal(t, []string{firstPath}, cfg.LoadedConfigFiles)
+
+		// files from the env var are used if the flag is not set
+		cfg = run(t)
+		assert.Equal(t, "ignored", cfg.Name)
+		assert.Equal(t, "Hi", cfg.Greeting)
+		assert.Equal(t, []string{secondPath}, cfg.LoadedConfigFiles)
+	})
+
+	t.Run("BindCommand with missing file", func(t *testing.T) {
+		greetCmd, err := NewCommand(&config{}, "greet", nil)
+		require.NoError(t, err)
+
+		err = greetCmd.Run(context.Background(), []string{"greet", "--config", path.Join(dir, "missing.toml")})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to read file")
+	})
 }
 
 func Test_BindCommandValidatesBeforeAction(t *testing.T) {
@@ -547,3 +3002,62 @@ Configuration error: NumberBetween0to10 - gte
 		})
 	}
 }
+
+func Test_MarshalAsMap(t *testing.T) {
+	type config struct {
+		Name     string
+		Password string `secret:"true"`
+		Origins  []string
+		Timeouts []time.Duration
+		Empty    []int
+		Labels   map[string]string
+		Addr     netip.Addr
+		Colors   []testColor
+		Nested   struct {
+			Ports []int
+		}
+	}
+
+	cfg := &config{
+		Name:     "tilebox",
+		Password: "very-secret-password",
+		Origins:  []string{"a.com", "b.com"},
+		Timeouts: []time.Duration{time.Second},
+		Labels:   map[string]string{"team": "core"},
+		Addr:     netip.MustParseAddr("10.0.0.1"),
+		Colors:   []testColor{testColorRed, testColorBlue},
+	}
+	cfg.Nested.Ports = []int{80, 443}
+
+	asMap, err := MarshalAsMap(cfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{
+		"name":     "tilebox",
+		"password": "ve***rd",
+		"origins":  []any{"a.com", "b.com"},
+		"timeouts": []any{"1s"},
+		"labels":   map[string]any{"team": "core"},
+		"addr":     "10.0.0.1",
+		"colors":   []any{"red", "blue"},
+		"nested": map[string]any{
+			"ports": []any{int64(80), int64(443)},
+		},
+	}, asMap)
+}
+
+func Test_MarshalAsMapEncoders(t *testing.T) {
+	type config struct {
+		Pattern *regexp.Regexp
+		Unset   *regexp.Regexp
+	}
+
+	cfg := &config{Pattern: regexp.MustCompile("^a+$")}
+
+	asMap, err := MarshalAsMap(cfg, WithEncoder(reflect.TypeFor[*regexp.Regexp](), func(value any) (string, error) {
+		return value.(*regexp.Regexp).String(), nil
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{"pattern": "^a+$"}, asMap)
+}
@@ -58,10 +58,11 @@ func init() { //nolint:gochecknoinits
 }
 
 type configFieldTags struct {
-	flag     string
-	aliases  []string
-	isGlobal bool
-	isSecret bool
+	flag        string
+	aliases     []string
+	isGlobal    bool
+	isSecret    bool
+	noEnvPrefix bool // whether the env var of the field is not prefixed by the prefix set by WithEnvPrefix
 
 	json string
 	toml string
@@ -71,16 +72,21 @@ type configFieldTags struct {
 
 	defaultValue string
 	help         string
+	layout       string // time layout for time.Time fields
+	merge        string // strategy for merging values from multiple config files
+	precedence   string // order of precedence of sources, overriding WithPrecedence
 }
 
 func parseTags(tag *reflect.StructTag) *configFieldTags {
 	isGlobal, _ := strconv.ParseBool(tag.Get("global"))
 	isSecret, _ := strconv.ParseBool(tag.Get("secret"))
+	envPrefix, err := strconv.ParseBool(tag.Get("envprefix"))
 
 	parsed := &configFieldTags{
-		flag:     tag.Get("flag"),
-		isGlobal: isGlobal,
-		isSecret: isSecret,
+		flag:        tag.Get("flag"),
+		isGlobal:    isGlobal,
+		isSecret:    isSecret,
+		noEnvPrefix: err == nil && !envPrefix,
 
 		json: tag.Get("json"),
 		toml: tag.Get("toml"),
@@ -89,6 +95,9 @@ func parseTags(tag *reflect.StructTag) *configFieldTags {
 		env:          tag.Get("env"),
 		defaultValue: tag.Get("default"),
 		help:         tag.Get("help"),
+		layout:       tag.Get("layout"),
+		merge:        tag.Get("merge"),
+		precedence:   tag.Get("precedence"),
 	}
 
 	alias := tag.Get("alias")
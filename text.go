@@ -0,0 +1,48 @@
+package structconf
+
+import (
+	"encoding"
+	"reflect"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	textMarshalerType   = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// isTextUnmarshaler returns whether the given type implements encoding.TextUnmarshaler, either on the value
+// itself or on a pointer to it.
+func isTextUnmarshaler(typ reflect.Type) bool {
+	return typ.Kind() != reflect.Ptr && reflect.PointerTo(typ).Implements(textUnmarshalerType)
+}
+
+// isTextMarshaler returns whether the given type implements encoding.TextMarshaler, either on the value
+// itself or on a pointer to it.
+func isTextMarshaler(typ reflect.Type) bool {
+	return typ.Kind() != reflect.Ptr && reflect.PointerTo(typ).Implements(textMarshalerType)
+}
+
+// unmarshalText parses the given string into a new value of the given type, using its encoding.TextUnmarshaler
+// implementation.
+func unmarshalText(typ reflect.Type, value string) (reflect.Value, error) {
+	parsed := reflect.New(typ)
+	if err := parsed.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value)); err != nil {
+		return reflect.Value{}, err
+	}
+
+	return parsed.Elem(), nil
+}
+
+// marshalText formats the given value using its encoding.TextMarshaler implementation.
+func marshalText(value reflect.Value) (string, error) {
+	// copy the value, so that we can also call MarshalText if it is implemented on the pointer receiver
+	pointer := reflect.New(value.Type())
+	pointer.Elem().Set(value)
+
+	text, err := pointer.Interface().(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return "", err
+	}
+
+	return string(text), nil
+}
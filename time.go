@@ -0,0 +1,84 @@
+package structconf
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+var (
+	timeType     = reflect.TypeFor[time.Time]()
+	locationType = reflect.TypeFor[*time.Location]()
+)
+
+// timeLayout returns the layout for parsing and formatting a time.Time field, as specified by its layout tag.
+func timeLayout(tags *configFieldTags) string {
+	if tags.layout != "" {
+		return tags.layout
+	}
+
+	return time.RFC3339
+}
+
+// timeFlag creates a timestamp flag for a time.Time field, parsed using the layout specified in the layout tag.
+//
+// In addition to the layout, RFC 3339 timestamps with optional fractional seconds are always accepted, which is
+// also the format native datetimes from config files are passed in.
+func timeFlag(field reflect.StructField, fieldValue reflect.Value, tags *configFieldTags, flagName string, sources cli.ValueSourceChain) (cli.Flag, func(*cli.Command), error) {
+	layout := timeLayout(tags)
+
+	var value time.Time
+	if tags.defaultValue != "" {
+		var err error
+		value, err = time.Parse(layout, tags.defaultValue)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse time %s for field %s: %w", tags.defaultValue, field.Name, err)
+		}
+	}
+
+	flag := &cli.TimestampFlag{
+		Name:        flagName,
+		Aliases:     tags.aliases,
+		Usage:       tags.help,
+		DefaultText: tags.defaultValue,
+		Value:       value,
+		Sources:     sources,
+		Config: cli.TimestampConfig{
+			Layouts: []string{layout, time.RFC3339Nano},
+		},
+	}
+
+	apply := func(cmd *cli.Command) {
+		fieldValue.Set(reflect.ValueOf(cmd.Timestamp(flagName)))
+	}
+
+	return flag, apply, nil
+}
+
+// parseTime returns a function parsing timestamps in the given layout, which like timeFlag also accepts RFC 3339
+// timestamps with optional fractional seconds, the format native datetimes from config files are passed in.
+func parseTime(layout string) func(string) (reflect.Value, error) {
+	return func(value string) (reflect.Value, error) {
+		parsed, err := time.Parse(layout, value)
+		if err != nil {
+			var nativeErr error
+			if parsed, nativeErr = time.Parse(time.RFC3339Nano, value); nativeErr != nil {
+				return reflect.Value{}, err
+			}
+		}
+
+		return reflect.ValueOf(parsed), nil
+	}
+}
+
+// parseLocation parses an IANA time zone name, such as "Europe/Berlin", into a *time.Location.
+func parseLocation(name string) (reflect.Value, error) {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	return reflect.ValueOf(location), nil
+}
@@ -2,10 +2,13 @@ package structconf
 
 import (
 	"fmt"
-	"os"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/BurntSushi/toml"
 	"github.com/urfave/cli/v3"
 )
 
@@ -13,8 +16,10 @@ import (
 // are fixed
 
 type mapSource struct {
-	name string
-	m    map[any]any
+	name   string
+	file   string // the config file the map was loaded from, if any
+	m      map[any]any
+	keyTag func(t *configFieldTags) string // the tag keys in the map are derived from, the toml tag if nil
 }
 
 func NewMapSource(name string, m map[any]any) cli.MapSource {
@@ -24,18 +29,53 @@ func NewMapSource(name string, m map[any]any) cli.MapSource {
 	}
 }
 
-func NewTomlFileSource(name string, file string) (cli.MapSource, error) {
-	data, err := os.ReadFile(file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file %q: %w", file, err)
+// newTaggedMapSource creates a map source for the given config file, whose keys are derived from the given tag, e.g. the
+// yaml tag for yaml files.
+func newTaggedMapSource(name string, file string, m map[string]any, keyTag func(t *configFieldTags) string) cli.MapSource {
+	container := make(map[any]any, len(m))
+	for k, v := range m {
+		container[k] = v
+	}
+
+	return &mapSource{
+		name:   name,
+		file:   file,
+		m:      container,
+		keyTag: keyTag,
+	}
+}
+
+// keyedMapSource is a map source which derives the keys of fields from their tags itself, instead of using the toml
+// tag of the field and all its parents joined with ".".
+type keyedMapSource interface {
+	cli.MapSource
+
+	// fieldKey returns the key of the given field in the source, or false if the field is excluded from the source.
+	fieldKey(tags *configFieldTags, parents []*configFieldTags) (string, bool)
+}
+
+// mapSourceKey returns the key of a field within the given map source. Sources not created by this package are keyed
+// by the toml tag of the field and all its parents, joined with ".".
+// Returns false if the field is excluded from the source by setting its tag to "-".
+func mapSourceKey(source cli.MapSource, tags *configFieldTags, parents []*configFieldTags) (string, bool) {
+	if keyed, ok := source.(keyedMapSource); ok {
+		return keyed.fieldKey(tags, parents)
 	}
 
-	container := make(map[any]any)
-	if err := toml.Unmarshal(data, &container); err != nil {
-		return nil, fmt.Errorf("failed to parse file as toml %q: %w", file, err)
+	return (&mapSource{}).fieldKey(tags, parents)
+}
+
+// NewTomlFileSource loads the given toml file, including all files listed by its top-level include key, e.g.
+// include = ["db.toml", "queues/*.toml"]. Included paths are relative to the including file, and the including file
+// takes precedence over the files it includes. The include key is reserved, so it is never looked up as the value of
+// a field.
+func NewTomlFileSource(name string, file string) (cli.MapSource, error) {
+	values, err := loadTomlFile(file, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	return NewMapSource(name, container), nil
+	return newTaggedMapSource(name, file, values, nil), nil
 }
 
 func (ms *mapSource) String() string { return fmt.Sprintf("map source %[1]q", ms.name) }
@@ -44,69 +84,206 @@ func (ms *mapSource) GoString() string {
 }
 
 func (ms *mapSource) Lookup(name string) (any, bool) {
-	node := ms.m
-	sections := strings.Split(name, ".")
-
-	if len(sections) == 0 {
-		return nil, false
-	}
+	var node any = ms.m
 
 	// recurse into the map, splitting the key on "."
-	if len(sections) > 1 {
-		for _, section := range sections[:len(sections)-1] {
-			child, ok := node[section]
-			if !ok {
-				return nil, false
-			}
-
-			switch child := child.(type) {
-			case map[string]any:
-				node = make(map[any]any, len(child))
-				for k, v := range child {
-					node[k] = v //nolint: modernize
-				}
-			case map[any]any:
-				node = child
-			default:
-				return nil, false
-			}
+	for _, section := range strings.Split(name, ".") {
+		child, ok := lookupSection(node, section)
+		if !ok {
+			return nil, false
 		}
+		node = child
 	}
 
-	// now lookup the last section
-	if val, ok := node[sections[len(sections)-1]]; ok {
-		return val, true
+	// null values in yaml and json files are treated like missing keys, so that other sources are used instead
+	return node, node != nil
+}
+
+func (ms *mapSource) fieldKey(tags *configFieldTags, parents []*configFieldTags) (string, bool) {
+	keyTag := ms.keyTag
+	if keyTag == nil {
+		keyTag = func(t *configFieldTags) string { return t.toml }
 	}
 
-	return nil, false
+	if key := keyTag(tags); key == "" || key == "-" {
+		return "", false
+	}
+
+	return fieldKey(tags, parents, keyTag, "."), true
+}
+
+// lookupSection looks up a single section of a key in the given node. Tables are indexed by name, and arrays
+// (e.g. arrays of tables) by the position of the element.
+func lookupSection(node any, section string) (any, bool) {
+	switch node := node.(type) {
+	case map[any]any:
+		child, ok := node[section]
+		return child, ok
+	case map[string]any:
+		child, ok := node[section]
+		return child, ok
+	case []map[string]any:
+		index, err := strconv.Atoi(section)
+		if err != nil || index < 0 || index >= len(node) {
+			return nil, false
+		}
+		return node[index], true
+	case []any:
+		index, err := strconv.Atoi(section)
+		if err != nil || index < 0 || index >= len(node) {
+			return nil, false
+		}
+		return node[index], true
+	default:
+		return nil, false
+	}
 }
 
 type mapsValueSource struct {
-	key  string
+	keys []string // the key to look up in each of the maps
 	maps []cli.MapSource
 }
 
 func (mvs *mapsValueSource) String() string {
-	return fmt.Sprintf("key %[1]q from %[2]d maps", mvs.key, len(mvs.maps))
+	return fmt.Sprintf("keys %[1]q from %[2]d maps", mvs.keys, len(mvs.maps))
 }
 
 func (mvs *mapsValueSource) GoString() string {
-	return fmt.Sprintf("&mapsValueSource{key:%[1]q, src:%[2]v}", mvs.key, mvs.maps)
+	return fmt.Sprintf("&mapsValueSource{keys:%[1]q, src:%[2]v}", mvs.keys, mvs.maps)
 }
 
 func (mvs *mapsValueSource) Lookup() (string, bool) {
-	for _, ms := range mvs.maps {
-		if v, ok := ms.Lookup(mvs.key); ok { // return the first defaultValue found
-			return fmt.Sprintf("%+v", v), true
+	for i, ms := range mvs.maps {
+		if v, ok := ms.Lookup(mvs.keys[i]); ok { // return the first defaultValue found
+			return formatMapValue(v), true
 		}
 	}
 
 	return "", false
 }
 
+// formatMapValue formats a value read from a map source as string, so that it can be parsed by a flag.
+// Arrays are formatted as comma separated list of their elements, which is what slice flags expect, and
+// tables as comma separated list of key=value pairs, which is what map flags expect.
+func formatMapValue(value any) string {
+	switch value := value.(type) {
+	case []any:
+		elements := make([]string, len(value))
+		for i, element := range value {
+			elements[i] = formatMapValue(element)
+		}
+		return strings.Join(elements, ",")
+	case map[string]any:
+		keys := slices.Sorted(maps.Keys(value))
+		elements := make([]string, len(keys))
+		for i, key := range keys {
+			elements[i] = key + "=" + formatMapValue(value[key])
+		}
+		return strings.Join(elements, ",")
+	case time.Time: // native toml datetimes, which time flags accept in addition to their own layout
+		return value.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprintf("%+v", value)
+	}
+}
+
 func NewValueSourceFromMaps(key string, sources ...cli.MapSource) cli.ValueSource {
+	keys := make([]string, len(sources))
+	for i := range sources {
+		keys[i] = key
+	}
+
 	return &mapsValueSource{
-		key:  key,
+		keys: keys,
 		maps: sources,
 	}
 }
+
+// mapSourceGroup is a map source consisting of other map sources, which are looked up in order, each using the key
+// of the field matching its format.
+type mapSourceGroup interface {
+	cli.MapSource
+
+	mapSources() []cli.MapSource
+}
+
+// fieldValueSource looks up a field in a list of map sources, using the key matching the format of each source. If the
+// field is found in multiple sources, their values are merged according to the merge tag of the field.
+type fieldValueSource struct {
+	tags    *configFieldTags
+	parents []*configFieldTags
+	sources []cli.MapSource
+}
+
+// newFieldValueSource creates a value source looking up the given field in all map sources, using the key matching
+// the format of each source.
+func newFieldValueSource(tags *configFieldTags, parents []*configFieldTags, sources []cli.MapSource) *fieldValueSource {
+	return &fieldValueSource{
+		tags:    tags,
+		parents: parents,
+		sources: sources,
+	}
+}
+
+func (fvs *fieldValueSource) String() string {
+	return fmt.Sprintf("field %[1]q from %[2]d maps", fvs.tags.toml, len(fvs.sources))
+}
+
+func (fvs *fieldValueSource) GoString() string {
+	return fmt.Sprintf("&fieldValueSource{field:%[1]q, src:%[2]v}", fvs.tags.toml, fvs.sources)
+}
+
+func (fvs *fieldValueSource) Lookup() (string, bool) {
+	value, ok := fvs.lookupValue()
+	if !ok {
+		return "", false
+	}
+
+	return formatMapValue(value), true
+}
+
+// lookupValue returns the value of the field, merged from all sources defining it, as read from the sources.
+func (fvs *fieldValueSource) lookupValue() (any, bool) {
+	values := fvs.lookup(fvs.sources)
+	if len(values) == 0 {
+		return nil, false
+	}
+
+	return mergeValues(values, fvs.tags.merge), true
+}
+
+// lookup returns the values of the field in all given sources, in order of precedence.
+func (fvs *fieldValueSource) lookup(sources []cli.MapSource) []any {
+	var values []any
+
+	for _, source := range sources {
+		if group, ok := source.(mapSourceGroup); ok {
+			values = append(values, fvs.lookup(group.mapSources())...)
+			continue
+		}
+
+		key, ok := mapSourceKey(source, fvs.tags, fvs.parents)
+		if !ok {
+			continue
+		}
+
+		if v, ok := source.Lookup(key); ok {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// NewConfigFileSource loads the given config file, choosing its format by the file extension: .yaml and .yml files are
+// parsed as yaml, .json files as json and all other files as toml.
+func NewConfigFileSource(file string) (cli.MapSource, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return NewYamlFileSource("yaml", file)
+	case ".json":
+		return NewJSONFileSource("json", file)
+	default:
+		return NewTomlFileSource("toml", file)
+	}
+}
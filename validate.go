@@ -2,33 +2,114 @@ package structconf
 
 import (
 	"bytes"
+	"cmp"
 	"errors"
 	"fmt"
+	"reflect"
+	"slices"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
 
 func validate(configPointer any) error {
 	configValidator := validator.New(validator.WithRequiredStructEnabled())
+	errorMessage := &bytes.Buffer{}
 
 	err := configValidator.Struct(configPointer)
-	if err != nil {
-		var validationErrors validator.ValidationErrors
-		if errors.As(err, &validationErrors) {
-			errorMessage := &bytes.Buffer{}
-
-			for _, fieldError := range validationErrors {
-				validationTag := fieldError.Tag()
-				if validationTag == "required" {
-					fmt.Fprintf(errorMessage, "Missing required configuration: %s\n", fieldError.Namespace())
-				} else {
-					fmt.Fprintf(errorMessage, "Configuration error: %s - %s\n", fieldError.StructField(), fieldError.ActualTag())
-				}
+	writeValidationErrors(errorMessage, err, "")
+
+	rootValue := reflect.Indirect(reflect.ValueOf(configPointer))
+	if rootValue.Kind() == reflect.Struct {
+		validateCollections(configValidator, errorMessage, rootValue, rootValue.Type().Name())
+	}
+
+	if errorMessage.Len() > 0 {
+		return errors.New(errorMessage.String())
+	}
+
+	return nil
+}
+
+// writeValidationErrors writes a message for each validation error in err to errorMessage. For elements of
+// collections, path is the path to the element, e.g. AppConfig.Upstreams[0], which replaces the name of the element
+// type in the reported namespaces.
+func writeValidationErrors(errorMessage *bytes.Buffer, err error, path string) {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return
+	}
+
+	for _, fieldError := range validationErrors {
+		namespace := fieldError.Namespace()
+		field := fieldError.StructField()
+		if path != "" {
+			_, relative, _ := strings.Cut(namespace, ".")
+			namespace = path + "." + relative
+			_, field, _ = strings.Cut(namespace, ".") // include the path to the element, but not the root type name
+		}
+
+		validationTag := fieldError.Tag()
+		if validationTag == "required" {
+			fmt.Fprintf(errorMessage, "Missing required configuration: %s\n", namespace)
+		} else {
+			fmt.Fprintf(errorMessage, "Configuration error: %s - %s\n", field, fieldError.ActualTag())
+		}
+	}
+}
+
+// validateCollections validates every element of the slices and maps of structs within the given struct, since the
+// validator only does so for fields with an explicit dive tag.
+func validateCollections(configValidator *validator.Validate, errorMessage *bytes.Buffer, structValue reflect.Value, path string) {
+	structType := structValue.Type()
+
+	for i := range structType.NumField() {
+		fieldType := structType.Field(i)
+		fieldValue := structValue.Field(i)
+
+		if !fieldType.IsExported() || isTextUnmarshaler(fieldType.Type) {
+			continue
+		}
+
+		fieldPath := path + "." + fieldType.Name
+
+		switch fieldType.Type.Kind() { //nolint:exhaustive  // only structs and collections can contain nested structs
+		case reflect.Struct:
+			validateCollections(configValidator, errorMessage, fieldValue, fieldPath)
+		case reflect.Ptr:
+			if !fieldValue.IsNil() && fieldValue.Elem().Kind() == reflect.Struct {
+				validateCollections(configValidator, errorMessage, fieldValue.Elem(), fieldPath)
+			}
+		case reflect.Slice:
+			if strings.Contains(fieldType.Tag.Get("validate"), "dive") { // already validated by the validator
+				continue
 			}
 
-			return errors.New(errorMessage.String())
+			for index := range fieldValue.Len() {
+				validateStructElem(configValidator, errorMessage, fieldValue.Index(index), fmt.Sprintf("%s[%d]", fieldPath, index))
+			}
+		case reflect.Map:
+			if strings.Contains(fieldType.Tag.Get("validate"), "dive") { // already validated by the validator
+				continue
+			}
+
+			keys := fieldValue.MapKeys()
+			slices.SortFunc(keys, func(a, b reflect.Value) int { return cmp.Compare(fmt.Sprint(a), fmt.Sprint(b)) })
+			for _, key := range keys {
+				validateStructElem(configValidator, errorMessage, fieldValue.MapIndex(key), fmt.Sprintf("%s[%v]", fieldPath, key))
+			}
 		}
 	}
+}
 
-	return nil
+// validateStructElem validates a single element of a collection, if it is a struct or a non-nil pointer to a struct.
+func validateStructElem(configValidator *validator.Validate, errorMessage *bytes.Buffer, elem reflect.Value, path string) {
+	elem = reflect.Indirect(elem)
+	if elem.Kind() != reflect.Struct || isTextUnmarshaler(elem.Type()) {
+		return
+	}
+
+	err := configValidator.Struct(elem.Interface())
+	writeValidationErrors(errorMessage, err, path)
+	validateCollections(configValidator, errorMessage, elem, path)
 }
@@ -0,0 +1,25 @@
+package structconf
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// NewYamlFileSource loads the given yaml file as map source. Keys in the file are derived from the yaml tag of the
+// config fields, which defaults to kebab case.
+func NewYamlFileSource(name string, file string) (cli.MapSource, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %q: %w", file, err)
+	}
+
+	container := make(map[string]any)
+	if err := yaml.Unmarshal(data, &container); err != nil {
+		return nil, fmt.Errorf("failed to parse file as yaml %q: %w", file, err)
+	}
+
+	return newTaggedMapSource(name, file, container, func(t *configFieldTags) string { return t.yaml }), nil
+}